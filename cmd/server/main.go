@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,8 +9,13 @@ import (
 	"os/signal"
 	"syscall"
 
+	// Embed the timezone database so time expressions like
+	// "today 09:00 Europe/Berlin" work in minimal container images
+	_ "time/tzdata"
+
 	"github.com/mark3labs/mcp-go/server"
 
+	"github.com/scottlepp/loki-mcp/internal/config"
 	"github.com/scottlepp/loki-mcp/internal/handlers"
 )
 
@@ -18,6 +24,19 @@ const (
 )
 
 func main() {
+	configPath := flag.String("config", os.Getenv(config.EnvConfigFile), "Path to a YAML or JSON file defining named Loki datasources")
+	flag.Parse()
+
+	// Load named datasources before creating the tools so their schemas list them
+	if *configPath != "" {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to load config: %v", err)
+		}
+		handlers.SetConfig(cfg)
+		log.Printf("Loaded %d Loki datasources from %s", len(cfg.Datasources), *configPath)
+	}
+
 	// Create a new MCP server
 	s := server.NewMCPServer(
 		"Loki MCP Server",
@@ -30,6 +49,50 @@ func main() {
 	lokiQueryTool := handlers.NewLokiQueryTool()
 	s.AddTool(lokiQueryTool, handlers.HandleLokiQuery)
 
+	// Add Loki instant query tool
+	lokiInstantQueryTool := handlers.NewLokiInstantQueryTool()
+	s.AddTool(lokiInstantQueryTool, handlers.HandleLokiInstantQuery)
+
+	// Add Loki label discovery tools
+	lokiLabelNamesTool := handlers.NewLokiLabelNamesTool()
+	s.AddTool(lokiLabelNamesTool, handlers.HandleLokiLabelNames)
+
+	lokiLabelValuesTool := handlers.NewLokiLabelValuesTool()
+	s.AddTool(lokiLabelValuesTool, handlers.HandleLokiLabelValues)
+
+	// Add Loki series tool
+	lokiSeriesTool := handlers.NewLokiSeriesTool()
+	s.AddTool(lokiSeriesTool, handlers.HandleLokiSeries)
+
+	// Add Loki query statistics and volume tools
+	lokiIndexStatsTool := handlers.NewLokiIndexStatsTool()
+	s.AddTool(lokiIndexStatsTool, handlers.HandleLokiIndexStats)
+
+	lokiVolumeTool := handlers.NewLokiVolumeTool()
+	s.AddTool(lokiVolumeTool, handlers.HandleLokiVolume)
+
+	lokiVolumeRangeTool := handlers.NewLokiVolumeRangeTool()
+	s.AddTool(lokiVolumeRangeTool, handlers.HandleLokiVolumeRange)
+
+	// Add Loki live tail tool
+	lokiTailTool := handlers.NewLokiTailTool()
+	s.AddTool(lokiTailTool, handlers.HandleLokiTail)
+
+	// Add Loki pattern detection tool
+	lokiPatternsTool := handlers.NewLokiPatternsTool()
+	s.AddTool(lokiPatternsTool, handlers.HandleLokiPatterns)
+
+	// Add Loki detected fields and labels tools
+	lokiDetectedFieldsTool := handlers.NewLokiDetectedFieldsTool()
+	s.AddTool(lokiDetectedFieldsTool, handlers.HandleLokiDetectedFields)
+
+	lokiDetectedLabelsTool := handlers.NewLokiDetectedLabelsTool()
+	s.AddTool(lokiDetectedLabelsTool, handlers.HandleLokiDetectedLabels)
+
+	// Add Grafana datasource listing tool
+	lokiGrafanaDatasourcesTool := handlers.NewLokiGrafanaDatasourcesTool()
+	s.AddTool(lokiGrafanaDatasourcesTool, handlers.HandleLokiGrafanaDatasources)
+
 	// Get SSE port from environment variable or use default
 	ssePort := os.Getenv("SSE_PORT")
 	if ssePort == "" {
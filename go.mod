@@ -2,7 +2,12 @@ module github.com/scottlepp/loki-mcp
 
 go 1.24.1
 
-require github.com/mark3labs/mcp-go v0.18.0
+require (
+	github.com/gorilla/websocket v1.5.3
+	github.com/mark3labs/mcp-go v0.18.0
+	golang.org/x/oauth2 v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/google/uuid v1.6.0 // indirect
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variable name for the path of the datasource config file
+const EnvConfigFile = "LOKI_MCP_CONFIG"
+
+// Config is the server-side configuration loaded from a YAML or JSON file
+type Config struct {
+	// DefaultDatasource is used when a tool call does not select a
+	// datasource. It may be omitted when only one datasource is defined.
+	DefaultDatasource string       `json:"default_datasource,omitempty" yaml:"default_datasource,omitempty"`
+	Datasources       []Datasource `json:"datasources" yaml:"datasources"`
+	// ServerSideCredentials removes the credential arguments from the tool
+	// schemas and rejects credentials passed as tool arguments
+	ServerSideCredentials bool `json:"server_side_credentials,omitempty" yaml:"server_side_credentials,omitempty"`
+	// Timezone is the IANA timezone in which time expressions without an
+	// explicit zone, such as "today 09:00", are interpreted (default: UTC)
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+}
+
+// Datasource is a named Loki connection profile
+type Datasource struct {
+	Name     string `json:"name" yaml:"name"`
+	URL      string `json:"url" yaml:"url"`
+	OrgID    string `json:"org_id,omitempty" yaml:"org_id,omitempty"`
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+	Token    string `json:"token,omitempty" yaml:"token,omitempty"`
+	// PasswordFile and TokenFile are read when Password or Token are unset,
+	// so secrets can be kept out of the config file
+	PasswordFile string    `json:"password_file,omitempty" yaml:"password_file,omitempty"`
+	TokenFile    string    `json:"token_file,omitempty" yaml:"token_file,omitempty"`
+	TLS          TLSConfig `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// HTTP tunes timeouts, connection pooling and proxying
+	HTTP HTTPConfig `json:"http,omitempty" yaml:"http,omitempty"`
+	// Retry controls retries of transient failures such as 429 and 503
+	Retry RetryConfig `json:"retry,omitempty" yaml:"retry,omitempty"`
+	// OAuth2 obtains bearer tokens with the client-credentials grant
+	OAuth2 *OAuth2Config `json:"oauth2,omitempty" yaml:"oauth2,omitempty"`
+	// GrafanaDatasourceUID makes URL the address of a Grafana instance and
+	// sends Loki requests through its datasource proxy, authenticated with
+	// a Grafana service account token
+	GrafanaDatasourceUID string `json:"grafana_datasource_uid,omitempty" yaml:"grafana_datasource_uid,omitempty"`
+	// Headers are static headers sent with every request to the datasource
+	Headers map[string]HeaderValue `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Display selects the stream labels shown in query results
+	Display DisplayConfig `json:"display,omitempty" yaml:"display,omitempty"`
+	// DefaultLimit is the number of entries returned by queries that do not
+	// set a limit, and MaxLimit caps the limit a tool call may request
+	DefaultLimit int `json:"default_limit,omitempty" yaml:"default_limit,omitempty"`
+	MaxLimit     int `json:"max_limit,omitempty" yaml:"max_limit,omitempty"`
+}
+
+// Load reads and validates the config file at path. JSON files are accepted
+// as well, since JSON is a subset of YAML.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// Validate checks that datasources are named uniquely, have a URL and that
+// the default datasource exists
+func (c *Config) Validate() error {
+	seen := make(map[string]bool, len(c.Datasources))
+	for i, ds := range c.Datasources {
+		if ds.Name == "" {
+			return fmt.Errorf("datasource %d has no name", i+1)
+		}
+		if seen[ds.Name] {
+			return fmt.Errorf("duplicate datasource %q", ds.Name)
+		}
+		seen[ds.Name] = true
+
+		if ds.URL == "" {
+			return fmt.Errorf("datasource %q has no url", ds.Name)
+		}
+		if ds.OAuth2 != nil {
+			if err := ds.OAuth2.Validate(); err != nil {
+				return fmt.Errorf("datasource %q: %v", ds.Name, err)
+			}
+		}
+		if err := ds.HTTP.Validate(); err != nil {
+			return fmt.Errorf("datasource %q: %v", ds.Name, err)
+		}
+		if err := ds.Retry.Validate(); err != nil {
+			return fmt.Errorf("datasource %q: %v", ds.Name, err)
+		}
+		if err := validateHeaders(ds.Headers); err != nil {
+			return fmt.Errorf("datasource %q: %v", ds.Name, err)
+		}
+		if err := ds.Display.Validate(); err != nil {
+			return fmt.Errorf("datasource %q: %v", ds.Name, err)
+		}
+		if ds.DefaultLimit < 0 || ds.MaxLimit < 0 {
+			return fmt.Errorf("datasource %q has a negative limit", ds.Name)
+		}
+		if ds.MaxLimit > 0 && ds.DefaultLimit > ds.MaxLimit {
+			return fmt.Errorf("datasource %q has a default_limit above its max_limit", ds.Name)
+		}
+	}
+
+	if c.DefaultDatasource != "" && !seen[c.DefaultDatasource] {
+		return fmt.Errorf("default datasource %q is not defined", c.DefaultDatasource)
+	}
+	if _, err := LoadTimezone(c.Timezone); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Names returns the datasource names in alphabetical order
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Datasources))
+	for _, ds := range c.Datasources {
+		names = append(names, ds.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultName returns the name of the datasource used when none is
+// selected, or "" if there is no unambiguous default
+func (c *Config) DefaultName() string {
+	if c.DefaultDatasource != "" {
+		return c.DefaultDatasource
+	}
+	if len(c.Datasources) == 1 {
+		return c.Datasources[0].Name
+	}
+	return ""
+}
+
+// Datasource returns the datasource with the given name. An empty name
+// selects the default datasource.
+func (c *Config) Datasource(name string) (*Datasource, error) {
+	if name == "" {
+		name = c.DefaultName()
+		if name == "" {
+			return nil, fmt.Errorf("no datasource selected and no default datasource configured")
+		}
+	}
+
+	for i := range c.Datasources {
+		if c.Datasources[i].Name == name {
+			return &c.Datasources[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown datasource %q (available: %v)", name, c.Names())
+}
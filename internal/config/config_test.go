@@ -0,0 +1,130 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigFile writes config file contents to a temporary file
+func writeConfigFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestLoad_YAML tests loading named datasources from a YAML file
+func TestLoad_YAML(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+default_datasource: prod
+datasources:
+  - name: prod
+    url: https://loki.prod.internal
+    org_id: platform
+    token: prod-token
+    default_limit: 200
+    max_limit: 1000
+    tls:
+      ca_file: /etc/ssl/internal-ca.pem
+      server_name: loki.internal
+  - name: staging
+    url: http://loki.staging.internal:3100
+    username: admin
+    password: secret
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	prod, err := cfg.Datasource("")
+	if err != nil {
+		t.Fatalf("Default datasource lookup failed: %v", err)
+	}
+	if prod.Name != "prod" || prod.OrgID != "platform" || prod.Token != "prod-token" || prod.DefaultLimit != 200 || prod.MaxLimit != 1000 {
+		t.Errorf("Unexpected prod datasource: %+v", prod)
+	}
+	if prod.TLS.CAFile != "/etc/ssl/internal-ca.pem" || prod.TLS.ServerName != "loki.internal" {
+		t.Errorf("Unexpected prod TLS settings: %+v", prod.TLS)
+	}
+
+	staging, err := cfg.Datasource("staging")
+	if err != nil {
+		t.Fatalf("Datasource lookup failed: %v", err)
+	}
+	if staging.Username != "admin" || staging.Password != "secret" {
+		t.Errorf("Unexpected staging datasource: %+v", staging)
+	}
+
+	if names := strings.Join(cfg.Names(), ","); names != "prod,staging" {
+		t.Errorf("Unexpected names: %s", names)
+	}
+}
+
+// TestLoad_JSON tests that JSON config files are accepted
+func TestLoad_JSON(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{
+		"datasources": [
+			{"name": "eu-west", "url": "http://loki.eu-west:3100", "org_id": "tenant-a|tenant-b"}
+		]
+	}`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// A single datasource is the default even without default_datasource
+	ds, err := cfg.Datasource("")
+	if err != nil {
+		t.Fatalf("Default datasource lookup failed: %v", err)
+	}
+	if ds.Name != "eu-west" || ds.OrgID != "tenant-a|tenant-b" {
+		t.Errorf("Unexpected datasource: %+v", ds)
+	}
+}
+
+// TestLoad_Invalid tests that malformed and inconsistent config files are rejected
+func TestLoad_Invalid(t *testing.T) {
+	testCases := map[string]string{
+		"has no name":              "datasources:\n  - url: http://loki:3100\n",
+		"has no url":               "datasources:\n  - name: prod\n",
+		"duplicate datasource":     "datasources:\n  - name: prod\n    url: http://a\n  - name: prod\n    url: http://b\n",
+		"is not defined":           "default_datasource: dev\ndatasources:\n  - name: prod\n    url: http://a\n",
+		"above its max_limit":      "datasources:\n  - name: prod\n    url: http://a\n    default_limit: 50\n    max_limit: 10\n",
+		"failed to parse":          "datasources: [",
+		"failed to read config fi": "",
+	}
+
+	for expected, contents := range testCases {
+		t.Run(expected, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "missing.yaml")
+			if contents != "" {
+				path = writeConfigFile(t, "config.yaml", contents)
+			}
+			if _, err := Load(path); err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("Expected error containing %q, got %v", expected, err)
+			}
+		})
+	}
+}
+
+// TestConfigDatasource_Lookup tests datasource selection errors
+func TestConfigDatasource_Lookup(t *testing.T) {
+	cfg := &Config{Datasources: []Datasource{
+		{Name: "prod", URL: "http://prod"},
+		{Name: "staging", URL: "http://staging"},
+	}}
+
+	if _, err := cfg.Datasource(""); err == nil || !strings.Contains(err.Error(), "no default datasource") {
+		t.Errorf("Expected missing default error, got %v", err)
+	}
+	if _, err := cfg.Datasource("dev"); err == nil || !strings.Contains(err.Error(), `unknown datasource "dev"`) {
+		t.Errorf("Expected unknown datasource error, got %v", err)
+	}
+}
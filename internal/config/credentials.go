@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variable names for server-side Loki credentials
+const (
+	EnvLokiUsername     = "LOKI_USERNAME"
+	EnvLokiPassword     = "LOKI_PASSWORD"
+	EnvLokiPasswordFile = "LOKI_PASSWORD_FILE"
+	EnvLokiToken        = "LOKI_TOKEN"
+	EnvLokiTokenFile    = "LOKI_TOKEN_FILE"
+
+	// EnvServerSideCredentials enables the mode in which credentials are
+	// only resolved server-side and never accepted as tool arguments
+	EnvServerSideCredentials = "LOKI_MCP_SERVER_SIDE_CREDENTIALS"
+)
+
+// Credentials holds the basic auth or bearer token credentials for Loki
+type Credentials struct {
+	Username string
+	Password string
+	Token    string
+}
+
+// CredentialsFromEnv reads the credentials from the environment, loading the
+// password and token from files if the *_FILE variables are set
+func CredentialsFromEnv() (Credentials, error) {
+	password, err := ReadSecret(os.Getenv(EnvLokiPassword), os.Getenv(EnvLokiPasswordFile))
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to read %s: %v", EnvLokiPasswordFile, err)
+	}
+	token, err := ReadSecret(os.Getenv(EnvLokiToken), os.Getenv(EnvLokiTokenFile))
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to read %s: %v", EnvLokiTokenFile, err)
+	}
+
+	return Credentials{
+		Username: os.Getenv(EnvLokiUsername),
+		Password: password,
+		Token:    token,
+	}, nil
+}
+
+// Credentials returns the credentials of the datasource, loading the
+// password and token from files if configured
+func (d *Datasource) Credentials() (Credentials, error) {
+	password, err := ReadSecret(d.Password, d.PasswordFile)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to read password file of datasource %q: %v", d.Name, err)
+	}
+	token, err := ReadSecret(d.Token, d.TokenFile)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to read token file of datasource %q: %v", d.Name, err)
+	}
+
+	return Credentials{
+		Username: d.Username,
+		Password: password,
+		Token:    token,
+	}, nil
+}
+
+// ReadSecret returns value if it is set, otherwise the contents of file
+// with surrounding whitespace removed. The file is read on every call so
+// rotated secrets are picked up without a restart.
+func ReadSecret(value, file string) (string, error) {
+	if value != "" || file == "" {
+		return value, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// ServerSideCredentialsFromEnv reports whether the server-side credentials
+// mode is enabled in the environment
+func ServerSideCredentialsFromEnv() (bool, error) {
+	value := os.Getenv(EnvServerSideCredentials)
+	if value == "" {
+		return false, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %v", EnvServerSideCredentials, err)
+	}
+	return enabled, nil
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCredentialsFromEnv tests reading credentials from variables and secret files
+func TestCredentialsFromEnv(t *testing.T) {
+	t.Setenv(EnvLokiUsername, "loki")
+	t.Setenv(EnvLokiPasswordFile, writeConfigFile(t, "password", "s3cret\n"))
+	t.Setenv(EnvLokiToken, "inline-token")
+	t.Setenv(EnvLokiTokenFile, writeConfigFile(t, "token", "file-token"))
+
+	credentials, err := CredentialsFromEnv()
+	if err != nil {
+		t.Fatalf("CredentialsFromEnv failed: %v", err)
+	}
+
+	// The variable takes precedence over the file, and file contents are trimmed
+	expected := Credentials{Username: "loki", Password: "s3cret", Token: "inline-token"}
+	if credentials != expected {
+		t.Errorf("Expected %+v, got %+v", expected, credentials)
+	}
+}
+
+// TestCredentialsFromEnv_MissingFile tests that an unreadable secret file is reported
+func TestCredentialsFromEnv_MissingFile(t *testing.T) {
+	t.Setenv(EnvLokiPasswordFile, filepath.Join(t.TempDir(), "missing"))
+
+	if _, err := CredentialsFromEnv(); err == nil || !strings.Contains(err.Error(), EnvLokiPasswordFile) {
+		t.Errorf("Expected error mentioning %s, got %v", EnvLokiPasswordFile, err)
+	}
+}
+
+// TestDatasourceCredentials tests loading datasource secrets from files
+func TestDatasourceCredentials(t *testing.T) {
+	ds := &Datasource{
+		Name:         "prod",
+		Username:     "loki",
+		PasswordFile: writeConfigFile(t, "password", "from-file"),
+		TokenFile:    filepath.Join(t.TempDir(), "missing"),
+		Token:        "inline-token",
+	}
+
+	credentials, err := ds.Credentials()
+	if err != nil {
+		t.Fatalf("Credentials failed: %v", err)
+	}
+	expected := Credentials{Username: "loki", Password: "from-file", Token: "inline-token"}
+	if credentials != expected {
+		t.Errorf("Expected %+v, got %+v", expected, credentials)
+	}
+
+	ds.Token = ""
+	if _, err := ds.Credentials(); err == nil || !strings.Contains(err.Error(), `token file of datasource "prod"`) {
+		t.Errorf("Expected token file error, got %v", err)
+	}
+}
+
+// TestServerSideCredentialsFromEnv tests parsing of the server-side credentials switch
+func TestServerSideCredentialsFromEnv(t *testing.T) {
+	if enabled, err := ServerSideCredentialsFromEnv(); err != nil || enabled {
+		t.Errorf("Expected the mode to be disabled by default, got %v, %v", enabled, err)
+	}
+
+	t.Setenv(EnvServerSideCredentials, "true")
+	if enabled, err := ServerSideCredentialsFromEnv(); err != nil || !enabled {
+		t.Errorf("Expected the mode to be enabled, got %v, %v", enabled, err)
+	}
+
+	t.Setenv(EnvServerSideCredentials, "sometimes")
+	if _, err := ServerSideCredentialsFromEnv(); err == nil {
+		t.Errorf("Expected an error for an invalid value")
+	}
+}
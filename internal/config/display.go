@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Environment variable names for how stream labels are displayed
+const (
+	EnvLokiIncludeLabels    = "LOKI_INCLUDE_LABELS"
+	EnvLokiExcludeLabels    = "LOKI_EXCLUDE_LABELS"
+	EnvLokiHideCommonLabels = "LOKI_HIDE_COMMON_LABELS"
+)
+
+// DisplayConfig controls which stream labels are shown in formatted query
+// results. It does not change the query, only how its result is printed.
+type DisplayConfig struct {
+	// IncludeLabels lists the labels to show; empty means all labels.
+	// Names may use glob patterns such as k8s_*.
+	IncludeLabels []string `json:"include_labels,omitempty" yaml:"include_labels,omitempty"`
+	// ExcludeLabels lists labels to hide, applied after IncludeLabels
+	ExcludeLabels []string `json:"exclude_labels,omitempty" yaml:"exclude_labels,omitempty"`
+	// HideCommonLabels prints the labels shared by all streams once, above
+	// the streams, instead of in every stream header
+	HideCommonLabels bool `json:"hide_common_labels,omitempty" yaml:"hide_common_labels,omitempty"`
+}
+
+// DisplayConfigFromEnv reads the label display settings from the environment.
+// The label lists are comma separated.
+func DisplayConfigFromEnv() (DisplayConfig, error) {
+	cfg := DisplayConfig{
+		IncludeLabels: SplitLabelList(os.Getenv(EnvLokiIncludeLabels)),
+		ExcludeLabels: SplitLabelList(os.Getenv(EnvLokiExcludeLabels)),
+	}
+
+	if value := os.Getenv(EnvLokiHideCommonLabels); value != "" {
+		hide, err := strconv.ParseBool(value)
+		if err != nil {
+			return DisplayConfig{}, fmt.Errorf("invalid %s: %v", EnvLokiHideCommonLabels, err)
+		}
+		cfg.HideCommonLabels = hide
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return DisplayConfig{}, err
+	}
+	return cfg, nil
+}
+
+// SplitLabelList splits a comma-separated list of label names, dropping
+// empty entries
+func SplitLabelList(value string) []string {
+	var labels []string
+	for _, label := range strings.Split(value, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return labels
+}
+
+// IsZero reports whether no display settings are configured
+func (c DisplayConfig) IsZero() bool {
+	return len(c.IncludeLabels) == 0 && len(c.ExcludeLabels) == 0 && !c.HideCommonLabels
+}
+
+// Validate checks that the label patterns are well-formed
+func (c DisplayConfig) Validate() error {
+	return ValidateLabelPatterns(append(append([]string(nil), c.IncludeLabels...), c.ExcludeLabels...))
+}
+
+// ValidateLabelPatterns checks that label names and glob patterns are
+// well-formed
+func ValidateLabelPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid label pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// MatchLabel reports whether a label name matches any of the patterns
+func MatchLabel(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
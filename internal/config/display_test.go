@@ -0,0 +1,41 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestDisplayConfigFromEnv tests reading the label display settings from the environment
+func TestDisplayConfigFromEnv(t *testing.T) {
+	t.Setenv(EnvLokiIncludeLabels, "app, level,,namespace")
+	t.Setenv(EnvLokiExcludeLabels, "k8s_*")
+	t.Setenv(EnvLokiHideCommonLabels, "true")
+
+	cfg, err := DisplayConfigFromEnv()
+	if err != nil {
+		t.Fatalf("DisplayConfigFromEnv failed: %v", err)
+	}
+	expected := DisplayConfig{IncludeLabels: []string{"app", "level", "namespace"}, ExcludeLabels: []string{"k8s_*"}, HideCommonLabels: true}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, cfg)
+	}
+
+	t.Setenv(EnvLokiHideCommonLabels, "sometimes")
+	if _, err := DisplayConfigFromEnv(); err == nil || !strings.Contains(err.Error(), EnvLokiHideCommonLabels) {
+		t.Errorf("Expected boolean error, got %v", err)
+	}
+}
+
+// TestDisplayConfig_Validate tests that malformed glob patterns are rejected
+func TestDisplayConfig_Validate(t *testing.T) {
+	if err := (DisplayConfig{ExcludeLabels: []string{"pod", "k8s_*"}}).Validate(); err != nil {
+		t.Errorf("Expected valid patterns, got %v", err)
+	}
+	if err := (DisplayConfig{IncludeLabels: []string{"[app"}}).Validate(); err == nil {
+		t.Error("Expected an invalid pattern error")
+	}
+	if !MatchLabel([]string{"k8s_*"}, "k8s_pod") || MatchLabel([]string{"k8s_*"}, "pod") {
+		t.Error("Unexpected glob match result")
+	}
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variable name for static headers sent to Loki when no
+// datasource is used, as comma-separated Name=value pairs
+const EnvLokiHTTPHeaders = "LOKI_HTTP_HEADERS"
+
+// HeaderValue is the value of a custom HTTP header. In the config file it is
+// either a plain string or a mapping with exactly one of value, file or env.
+type HeaderValue struct {
+	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+	// File is read on every request so rotated values are picked up
+	File string `json:"file,omitempty" yaml:"file,omitempty"`
+	// Env names an environment variable holding the value
+	Env string `json:"env,omitempty" yaml:"env,omitempty"`
+}
+
+// UnmarshalYAML accepts a plain string as well as a value/file/env mapping
+func (h *HeaderValue) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*h = HeaderValue{Value: node.Value}
+		return nil
+	}
+
+	type plain HeaderValue
+	return node.Decode((*plain)(h))
+}
+
+// Validate checks that exactly one source is set
+func (h HeaderValue) Validate() error {
+	sources := 0
+	for _, source := range []string{h.Value, h.File, h.Env} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("exactly one of value, file or env must be set")
+	}
+	return nil
+}
+
+// Resolve returns the header value, reading it from its file or environment
+// variable if needed
+func (h HeaderValue) Resolve() (string, error) {
+	switch {
+	case h.File != "":
+		data, err := os.ReadFile(h.File)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	case h.Env != "":
+		value, ok := os.LookupEnv(h.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", h.Env)
+		}
+		return value, nil
+	default:
+		return h.Value, nil
+	}
+}
+
+// validateHeaders checks header names and values
+func validateHeaders(headers map[string]HeaderValue) error {
+	for name, value := range headers {
+		if !validHeaderName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if err := value.Validate(); err != nil {
+			return fmt.Errorf("header %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// ResolveHeaders returns the values of the configured headers
+func ResolveHeaders(headers map[string]HeaderValue) (map[string]string, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+
+	resolved := make(map[string]string, len(headers))
+	for name, value := range headers {
+		v, err := value.Resolve()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve header %s: %v", name, err)
+		}
+		resolved[name] = v
+	}
+	return resolved, nil
+}
+
+// HeadersFromEnv reads the static headers from the environment
+func HeadersFromEnv() (map[string]string, error) {
+	value := os.Getenv(EnvLokiHTTPHeaders)
+	if value == "" {
+		return nil, nil
+	}
+
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, v, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !validHeaderName(name) {
+			return nil, fmt.Errorf("invalid %s: expected Name=value pairs, got %q", EnvLokiHTTPHeaders, pair)
+		}
+		headers[name] = strings.TrimSpace(v)
+	}
+	return headers, nil
+}
+
+// validHeaderName reports whether name is a valid HTTP header field name
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r > 0x7e || r <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
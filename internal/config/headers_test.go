@@ -0,0 +1,85 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestLoad_Headers tests loading static headers given as strings, files and environment variables
+func TestLoad_Headers(t *testing.T) {
+	t.Setenv("CF_ACCESS_CLIENT_ID", "client-id")
+	secretFile := writeConfigFile(t, "cf-secret", "client-secret\n")
+
+	path := writeConfigFile(t, "datasources.yaml", `
+datasources:
+  - name: prod
+    url: https://loki.example.com
+    headers:
+      X-Grafana-Org-Id: "2"
+      CF-Access-Client-Id:
+        env: CF_ACCESS_CLIENT_ID
+      CF-Access-Client-Secret:
+        file: `+secretFile+`
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	headers, err := ResolveHeaders(cfg.Datasources[0].Headers)
+	if err != nil {
+		t.Fatalf("ResolveHeaders failed: %v", err)
+	}
+	expected := map[string]string{
+		"X-Grafana-Org-Id":        "2",
+		"CF-Access-Client-Id":     "client-id",
+		"CF-Access-Client-Secret": "client-secret",
+	}
+	for name, value := range expected {
+		if headers[name] != value {
+			t.Errorf("Expected %s=%q, got %q", name, value, headers[name])
+		}
+	}
+}
+
+// TestLoad_InvalidHeaders tests that malformed header definitions are rejected
+func TestLoad_InvalidHeaders(t *testing.T) {
+	testCases := map[string]string{
+		"invalid header name":  "      Bad Header: x\n",
+		"exactly one of value": "      X-Route:\n        value: a\n        env: B\n",
+	}
+
+	for expected, headers := range testCases {
+		path := writeConfigFile(t, "datasources.yaml", "datasources:\n  - name: prod\n    url: http://loki:3100\n    headers:\n"+headers)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error containing %q, got %v", expected, err)
+		}
+	}
+}
+
+// TestResolveHeaders_MissingEnv tests that an unset environment variable is reported
+func TestResolveHeaders_MissingEnv(t *testing.T) {
+	_, err := ResolveHeaders(map[string]HeaderValue{"X-Route": {Env: "LOKI_MCP_TEST_UNSET"}})
+	if err == nil || !strings.Contains(err.Error(), "LOKI_MCP_TEST_UNSET") {
+		t.Errorf("Expected missing variable error, got %v", err)
+	}
+}
+
+// TestHeadersFromEnv tests parsing Name=value pairs from the environment
+func TestHeadersFromEnv(t *testing.T) {
+	t.Setenv(EnvLokiHTTPHeaders, "X-Grafana-Org-Id=2, X-Route = eu-west")
+
+	headers, err := HeadersFromEnv()
+	if err != nil {
+		t.Fatalf("HeadersFromEnv failed: %v", err)
+	}
+	if headers["X-Grafana-Org-Id"] != "2" || headers["X-Route"] != "eu-west" {
+		t.Errorf("Unexpected headers: %v", headers)
+	}
+
+	t.Setenv(EnvLokiHTTPHeaders, "no-separator")
+	if _, err := HeadersFromEnv(); err == nil {
+		t.Errorf("Expected error for a pair without =")
+	}
+}
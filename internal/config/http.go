@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Environment variable names for the Loki HTTP client settings
+const (
+	EnvLokiHTTPTimeout             = "LOKI_HTTP_TIMEOUT"
+	EnvLokiHTTPMaxTimeout          = "LOKI_HTTP_MAX_TIMEOUT"
+	EnvLokiHTTPMaxIdleConns        = "LOKI_HTTP_MAX_IDLE_CONNS"
+	EnvLokiHTTPMaxIdleConnsPerHost = "LOKI_HTTP_MAX_IDLE_CONNS_PER_HOST"
+	EnvLokiHTTPMaxConnsPerHost     = "LOKI_HTTP_MAX_CONNS_PER_HOST"
+	EnvLokiHTTPIdleConnTimeout     = "LOKI_HTTP_IDLE_CONN_TIMEOUT"
+	EnvLokiHTTPKeepAlive           = "LOKI_HTTP_KEEP_ALIVE"
+	EnvLokiHTTPDisableKeepAlives   = "LOKI_HTTP_DISABLE_KEEP_ALIVES"
+	EnvLokiHTTPProxyURL            = "LOKI_HTTP_PROXY_URL"
+	EnvLokiHTTPDisableProxy        = "LOKI_HTTP_DISABLE_PROXY"
+)
+
+// HTTPConfig holds the HTTP client settings used to connect to Loki. Zero
+// values keep the defaults of the shared transport.
+type HTTPConfig struct {
+	// Timeout applies to a whole tool call, including retries and pages, and
+	// MaxTimeout caps the timeout a tool call may request
+	Timeout    time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	MaxTimeout time.Duration `json:"max_timeout,omitempty" yaml:"max_timeout,omitempty"`
+	// Connection pool sizes and how long idle connections are kept
+	MaxIdleConns        int           `json:"max_idle_conns,omitempty" yaml:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost int           `json:"max_idle_conns_per_host,omitempty" yaml:"max_idle_conns_per_host,omitempty"`
+	MaxConnsPerHost     int           `json:"max_conns_per_host,omitempty" yaml:"max_conns_per_host,omitempty"`
+	IdleConnTimeout     time.Duration `json:"idle_conn_timeout,omitempty" yaml:"idle_conn_timeout,omitempty"`
+	// KeepAlive is the TCP keep-alive period, and DisableKeepAlives opens a
+	// new connection for every request
+	KeepAlive         time.Duration `json:"keep_alive,omitempty" yaml:"keep_alive,omitempty"`
+	DisableKeepAlives bool          `json:"disable_keep_alives,omitempty" yaml:"disable_keep_alives,omitempty"`
+	// ProxyURL overrides the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+	// variables, and DisableProxy ignores them
+	ProxyURL     string `json:"proxy_url,omitempty" yaml:"proxy_url,omitempty"`
+	DisableProxy bool   `json:"disable_proxy,omitempty" yaml:"disable_proxy,omitempty"`
+}
+
+// HTTPConfigFromEnv reads the HTTP client settings from the environment
+func HTTPConfigFromEnv() (HTTPConfig, error) {
+	var cfg HTTPConfig
+	var err error
+
+	durations := map[string]*time.Duration{
+		EnvLokiHTTPTimeout:         &cfg.Timeout,
+		EnvLokiHTTPMaxTimeout:      &cfg.MaxTimeout,
+		EnvLokiHTTPIdleConnTimeout: &cfg.IdleConnTimeout,
+		EnvLokiHTTPKeepAlive:       &cfg.KeepAlive,
+	}
+	for name, d := range durations {
+		if value := os.Getenv(name); value != "" {
+			if *d, err = time.ParseDuration(value); err != nil {
+				return HTTPConfig{}, fmt.Errorf("invalid %s: %v", name, err)
+			}
+		}
+	}
+
+	ints := map[string]*int{
+		EnvLokiHTTPMaxIdleConns:        &cfg.MaxIdleConns,
+		EnvLokiHTTPMaxIdleConnsPerHost: &cfg.MaxIdleConnsPerHost,
+		EnvLokiHTTPMaxConnsPerHost:     &cfg.MaxConnsPerHost,
+	}
+	for name, n := range ints {
+		if value := os.Getenv(name); value != "" {
+			if *n, err = strconv.Atoi(value); err != nil {
+				return HTTPConfig{}, fmt.Errorf("invalid %s: %v", name, err)
+			}
+		}
+	}
+
+	bools := map[string]*bool{
+		EnvLokiHTTPDisableKeepAlives: &cfg.DisableKeepAlives,
+		EnvLokiHTTPDisableProxy:      &cfg.DisableProxy,
+	}
+	for name, b := range bools {
+		if value := os.Getenv(name); value != "" {
+			if *b, err = strconv.ParseBool(value); err != nil {
+				return HTTPConfig{}, fmt.Errorf("invalid %s: %v", name, err)
+			}
+		}
+	}
+
+	cfg.ProxyURL = os.Getenv(EnvLokiHTTPProxyURL)
+
+	if err := cfg.Validate(); err != nil {
+		return HTTPConfig{}, err
+	}
+	return cfg, nil
+}
+
+// IsZero reports whether no HTTP client settings are configured
+func (c HTTPConfig) IsZero() bool {
+	return c == HTTPConfig{}
+}
+
+// Validate checks that the settings are not negative, that the timeout does
+// not exceed the maximum timeout and that the proxy URL is valid
+func (c HTTPConfig) Validate() error {
+	if c.Timeout < 0 || c.MaxTimeout < 0 || c.IdleConnTimeout < 0 || c.KeepAlive < 0 {
+		return fmt.Errorf("http durations must not be negative")
+	}
+	if c.MaxIdleConns < 0 || c.MaxIdleConnsPerHost < 0 || c.MaxConnsPerHost < 0 {
+		return fmt.Errorf("http connection limits must not be negative")
+	}
+	if c.Timeout > 0 && c.MaxTimeout > 0 && c.Timeout > c.MaxTimeout {
+		return fmt.Errorf("http timeout %s exceeds max_timeout %s", c.Timeout, c.MaxTimeout)
+	}
+	if c.ProxyURL != "" {
+		if c.DisableProxy {
+			return fmt.Errorf("http proxy_url and disable_proxy cannot be combined")
+		}
+		u, err := url.Parse(c.ProxyURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid http proxy_url %q", c.ProxyURL)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoad_HTTP tests loading HTTP client settings with durations
+func TestLoad_HTTP(t *testing.T) {
+	path := writeConfigFile(t, "datasources.yaml", `
+datasources:
+  - name: prod
+    url: https://loki.example.com
+    http:
+      timeout: 2m
+      max_timeout: 10m
+      max_idle_conns_per_host: 20
+      idle_conn_timeout: 90s
+      proxy_url: http://proxy.example.com:3128
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	expected := HTTPConfig{
+		Timeout:             2 * time.Minute,
+		MaxTimeout:          10 * time.Minute,
+		MaxIdleConnsPerHost: 20,
+		IdleConnTimeout:     90 * time.Second,
+		ProxyURL:            "http://proxy.example.com:3128",
+	}
+	if cfg.Datasources[0].HTTP != expected {
+		t.Errorf("Expected %+v, got %+v", expected, cfg.Datasources[0].HTTP)
+	}
+}
+
+// TestHTTPConfigFromEnv tests reading HTTP client settings from the environment
+func TestHTTPConfigFromEnv(t *testing.T) {
+	t.Setenv(EnvLokiHTTPTimeout, "45s")
+	t.Setenv(EnvLokiHTTPMaxIdleConns, "50")
+	t.Setenv(EnvLokiHTTPDisableProxy, "true")
+
+	cfg, err := HTTPConfigFromEnv()
+	if err != nil {
+		t.Fatalf("HTTPConfigFromEnv failed: %v", err)
+	}
+	expected := HTTPConfig{Timeout: 45 * time.Second, MaxIdleConns: 50, DisableProxy: true}
+	if cfg != expected {
+		t.Errorf("Expected %+v, got %+v", expected, cfg)
+	}
+
+	t.Setenv(EnvLokiHTTPKeepAlive, "forever")
+	if _, err := HTTPConfigFromEnv(); err == nil || !strings.Contains(err.Error(), EnvLokiHTTPKeepAlive) {
+		t.Errorf("Expected error mentioning %s, got %v", EnvLokiHTTPKeepAlive, err)
+	}
+}
+
+// TestHTTPConfigValidate tests rejecting inconsistent HTTP client settings
+func TestHTTPConfigValidate(t *testing.T) {
+	testCases := map[string]HTTPConfig{
+		"must not be negative":   {MaxIdleConns: -1},
+		"exceeds max_timeout":    {Timeout: time.Hour, MaxTimeout: time.Minute},
+		"cannot be combined":     {ProxyURL: "http://proxy:3128", DisableProxy: true},
+		"invalid http proxy_url": {ProxyURL: "proxy"},
+	}
+
+	for expected, cfg := range testCases {
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error containing %q, got %v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Environment variable names for OAuth2 client-credentials authentication
+const (
+	EnvLokiOAuth2TokenURL         = "LOKI_OAUTH2_TOKEN_URL"
+	EnvLokiOAuth2ClientID         = "LOKI_OAUTH2_CLIENT_ID"
+	EnvLokiOAuth2ClientSecret     = "LOKI_OAUTH2_CLIENT_SECRET"
+	EnvLokiOAuth2ClientSecretFile = "LOKI_OAUTH2_CLIENT_SECRET_FILE"
+	EnvLokiOAuth2Scopes           = "LOKI_OAUTH2_SCOPES"
+)
+
+// OAuth2Config holds the settings for obtaining Loki access tokens with the
+// OAuth2 client-credentials grant
+type OAuth2Config struct {
+	TokenURL         string   `json:"token_url" yaml:"token_url"`
+	ClientID         string   `json:"client_id" yaml:"client_id"`
+	ClientSecret     string   `json:"client_secret,omitempty" yaml:"client_secret,omitempty"`
+	ClientSecretFile string   `json:"client_secret_file,omitempty" yaml:"client_secret_file,omitempty"`
+	Scopes           []string `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+	// EndpointParams are additional form parameters sent to the token
+	// endpoint, such as an audience
+	EndpointParams map[string]string `json:"endpoint_params,omitempty" yaml:"endpoint_params,omitempty"`
+}
+
+// OAuth2ConfigFromEnv reads the OAuth2 settings from the environment. It
+// returns nil if no token URL is configured.
+func OAuth2ConfigFromEnv() (*OAuth2Config, error) {
+	tokenURL := os.Getenv(EnvLokiOAuth2TokenURL)
+	if tokenURL == "" {
+		return nil, nil
+	}
+
+	cfg := &OAuth2Config{
+		TokenURL:         tokenURL,
+		ClientID:         os.Getenv(EnvLokiOAuth2ClientID),
+		ClientSecret:     os.Getenv(EnvLokiOAuth2ClientSecret),
+		ClientSecretFile: os.Getenv(EnvLokiOAuth2ClientSecretFile),
+	}
+	for _, scope := range strings.Split(os.Getenv(EnvLokiOAuth2Scopes), ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			cfg.Scopes = append(cfg.Scopes, scope)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks that the token URL and client ID are set
+func (c *OAuth2Config) Validate() error {
+	if c.TokenURL == "" {
+		return fmt.Errorf("oauth2 token_url is required")
+	}
+	if c.ClientID == "" {
+		return fmt.Errorf("oauth2 client_id is required")
+	}
+	return nil
+}
+
+// Secret returns the client secret, loading it from ClientSecretFile if
+// ClientSecret is unset
+func (c *OAuth2Config) Secret() (string, error) {
+	secret, err := ReadSecret(c.ClientSecret, c.ClientSecretFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read oauth2 client secret file: %v", err)
+	}
+	return secret, nil
+}
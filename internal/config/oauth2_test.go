@@ -0,0 +1,33 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestOAuth2ConfigFromEnv tests reading the client-credentials settings from the environment
+func TestOAuth2ConfigFromEnv(t *testing.T) {
+	if cfg, err := OAuth2ConfigFromEnv(); cfg != nil || err != nil {
+		t.Fatalf("Expected no OAuth2 config without a token URL, got %+v, %v", cfg, err)
+	}
+
+	t.Setenv(EnvLokiOAuth2TokenURL, "https://auth.example.com/token")
+	if _, err := OAuth2ConfigFromEnv(); err == nil || !strings.Contains(err.Error(), "client_id") {
+		t.Errorf("Expected missing client_id error, got %v", err)
+	}
+
+	t.Setenv(EnvLokiOAuth2ClientID, "loki-mcp")
+	t.Setenv(EnvLokiOAuth2ClientSecretFile, writeConfigFile(t, "secret", "s3cret\n"))
+	t.Setenv(EnvLokiOAuth2Scopes, "logs:read, logs:write")
+
+	cfg, err := OAuth2ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("OAuth2ConfigFromEnv failed: %v", err)
+	}
+	if strings.Join(cfg.Scopes, ",") != "logs:read,logs:write" {
+		t.Errorf("Unexpected scopes: %v", cfg.Scopes)
+	}
+	if secret, err := cfg.Secret(); err != nil || secret != "s3cret" {
+		t.Errorf("Expected the secret from the file, got %q, %v", secret, err)
+	}
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Environment variable names for the retry policy of Loki requests
+const (
+	EnvLokiRetryMaxAttempts    = "LOKI_RETRY_MAX_ATTEMPTS"
+	EnvLokiRetryInitialBackoff = "LOKI_RETRY_INITIAL_BACKOFF"
+	EnvLokiRetryMaxBackoff     = "LOKI_RETRY_MAX_BACKOFF"
+)
+
+// RetryConfig holds the retry policy for transient Loki failures. Zero
+// values keep the defaults; MaxAttempts of 1 disables retries.
+type RetryConfig struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int `json:"max_attempts,omitempty" yaml:"max_attempts,omitempty"`
+	// InitialBackoff is doubled after every attempt up to MaxBackoff
+	InitialBackoff time.Duration `json:"initial_backoff,omitempty" yaml:"initial_backoff,omitempty"`
+	MaxBackoff     time.Duration `json:"max_backoff,omitempty" yaml:"max_backoff,omitempty"`
+}
+
+// RetryConfigFromEnv reads the retry policy from the environment
+func RetryConfigFromEnv() (RetryConfig, error) {
+	var cfg RetryConfig
+	var err error
+
+	if value := os.Getenv(EnvLokiRetryMaxAttempts); value != "" {
+		if cfg.MaxAttempts, err = strconv.Atoi(value); err != nil {
+			return RetryConfig{}, fmt.Errorf("invalid %s: %v", EnvLokiRetryMaxAttempts, err)
+		}
+	}
+	if value := os.Getenv(EnvLokiRetryInitialBackoff); value != "" {
+		if cfg.InitialBackoff, err = time.ParseDuration(value); err != nil {
+			return RetryConfig{}, fmt.Errorf("invalid %s: %v", EnvLokiRetryInitialBackoff, err)
+		}
+	}
+	if value := os.Getenv(EnvLokiRetryMaxBackoff); value != "" {
+		if cfg.MaxBackoff, err = time.ParseDuration(value); err != nil {
+			return RetryConfig{}, fmt.Errorf("invalid %s: %v", EnvLokiRetryMaxBackoff, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return RetryConfig{}, err
+	}
+	return cfg, nil
+}
+
+// IsZero reports whether no retry settings are configured
+func (c RetryConfig) IsZero() bool {
+	return c == RetryConfig{}
+}
+
+// Validate checks that the settings are not negative and that the initial
+// backoff does not exceed the maximum backoff
+func (c RetryConfig) Validate() error {
+	if c.MaxAttempts < 0 || c.InitialBackoff < 0 || c.MaxBackoff < 0 {
+		return fmt.Errorf("retry settings must not be negative")
+	}
+	if c.InitialBackoff > 0 && c.MaxBackoff > 0 && c.InitialBackoff > c.MaxBackoff {
+		return fmt.Errorf("retry initial_backoff %s exceeds max_backoff %s", c.InitialBackoff, c.MaxBackoff)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRetryConfigFromEnv tests reading the retry policy from the environment
+func TestRetryConfigFromEnv(t *testing.T) {
+	t.Setenv(EnvLokiRetryMaxAttempts, "5")
+	t.Setenv(EnvLokiRetryInitialBackoff, "250ms")
+	t.Setenv(EnvLokiRetryMaxBackoff, "5s")
+
+	cfg, err := RetryConfigFromEnv()
+	if err != nil {
+		t.Fatalf("RetryConfigFromEnv failed: %v", err)
+	}
+	expected := RetryConfig{MaxAttempts: 5, InitialBackoff: 250 * time.Millisecond, MaxBackoff: 5 * time.Second}
+	if cfg != expected {
+		t.Errorf("Expected %+v, got %+v", expected, cfg)
+	}
+
+	t.Setenv(EnvLokiRetryInitialBackoff, "1m")
+	if _, err := RetryConfigFromEnv(); err == nil || !strings.Contains(err.Error(), "exceeds max_backoff") {
+		t.Errorf("Expected backoff error, got %v", err)
+	}
+}
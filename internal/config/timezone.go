@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Environment variable name for the default timezone of time expressions
+const EnvTimezone = "LOKI_MCP_TIMEZONE"
+
+// LoadTimezone returns the location named by an IANA timezone name such as
+// Europe/Berlin, or UTC or Local. An empty name selects UTC.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %v", name, err)
+	}
+	return loc, nil
+}
+
+// TimezoneFromEnv returns the default timezone configured in the
+// environment, or UTC if none is set
+func TimezoneFromEnv() (*time.Location, error) {
+	loc, err := LoadTimezone(os.Getenv(EnvTimezone))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", EnvTimezone, err)
+	}
+	return loc, nil
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestTimezoneFromEnv tests reading the default timezone from the environment
+func TestTimezoneFromEnv(t *testing.T) {
+	t.Setenv(EnvTimezone, "")
+	loc, err := TimezoneFromEnv()
+	if err != nil || loc.String() != "UTC" {
+		t.Errorf("Expected UTC by default, got %v (%v)", loc, err)
+	}
+
+	t.Setenv(EnvTimezone, "Europe/Berlin")
+	loc, err = TimezoneFromEnv()
+	if err != nil || loc.String() != "Europe/Berlin" {
+		t.Errorf("Expected Europe/Berlin, got %v (%v)", loc, err)
+	}
+
+	t.Setenv(EnvTimezone, "Mars/Olympus_Mons")
+	if _, err := TimezoneFromEnv(); err == nil || !strings.Contains(err.Error(), EnvTimezone) {
+		t.Errorf("Expected timezone error, got %v", err)
+	}
+}
+
+// TestValidate_Timezone tests that an unknown timezone in the config file is rejected
+func TestValidate_Timezone(t *testing.T) {
+	cfg := Config{Timezone: "Europe/Berlin"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+
+	cfg.Timezone = "Nowhere/Special"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "invalid timezone") {
+		t.Errorf("Expected timezone error, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Environment variable names for Loki TLS settings
+const (
+	EnvLokiCAFile             = "LOKI_CA_FILE"
+	EnvLokiClientCertFile     = "LOKI_CLIENT_CERT_FILE"
+	EnvLokiClientKeyFile      = "LOKI_CLIENT_KEY_FILE"
+	EnvLokiTLSServerName      = "LOKI_TLS_SERVER_NAME"
+	EnvLokiInsecureSkipVerify = "LOKI_TLS_INSECURE_SKIP_VERIFY"
+)
+
+// TLSConfig holds the TLS settings used to connect to Loki
+type TLSConfig struct {
+	// CAFile is a PEM bundle of certificate authorities to trust in
+	// addition to the system roots
+	CAFile string `json:"ca_file,omitempty" yaml:"ca_file,omitempty"`
+	// CertFile and KeyFile are the client certificate and key for mTLS
+	CertFile string `json:"cert_file,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+	// ServerName overrides the host name used to verify the server certificate
+	ServerName string `json:"server_name,omitempty" yaml:"server_name,omitempty"`
+	// InsecureSkipVerify disables server certificate verification entirely
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+}
+
+// TLSConfigFromEnv reads the TLS settings from the environment
+func TLSConfigFromEnv() (TLSConfig, error) {
+	cfg := TLSConfig{
+		CAFile:     os.Getenv(EnvLokiCAFile),
+		CertFile:   os.Getenv(EnvLokiClientCertFile),
+		KeyFile:    os.Getenv(EnvLokiClientKeyFile),
+		ServerName: os.Getenv(EnvLokiTLSServerName),
+	}
+
+	if insecure := os.Getenv(EnvLokiInsecureSkipVerify); insecure != "" {
+		skip, err := strconv.ParseBool(insecure)
+		if err != nil {
+			return TLSConfig{}, fmt.Errorf("invalid %s: %v", EnvLokiInsecureSkipVerify, err)
+		}
+		cfg.InsecureSkipVerify = skip
+	}
+
+	return cfg, nil
+}
+
+// IsZero reports whether no TLS settings are configured
+func (c TLSConfig) IsZero() bool {
+	return c == TLSConfig{}
+}
+
+// Build loads the configured certificates and returns the resulting
+// *tls.Config. It returns nil if no TLS settings are configured, so the
+// defaults of the HTTP transport apply.
+func (c TLSConfig) Build() (*tls.Config, error) {
+	if c.IsZero() {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		caPEM, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, fmt.Errorf("both a client certificate and key are required for mTLS")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
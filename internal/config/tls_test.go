@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTLSConfigFromEnv tests that TLS settings are read from the environment
+func TestTLSConfigFromEnv(t *testing.T) {
+	t.Setenv(EnvLokiCAFile, "/etc/ssl/loki-ca.pem")
+	t.Setenv(EnvLokiClientCertFile, "/etc/ssl/client.pem")
+	t.Setenv(EnvLokiClientKeyFile, "/etc/ssl/client-key.pem")
+	t.Setenv(EnvLokiTLSServerName, "loki.internal")
+	t.Setenv(EnvLokiInsecureSkipVerify, "true")
+
+	cfg, err := TLSConfigFromEnv()
+	if err != nil {
+		t.Fatalf("TLSConfigFromEnv failed: %v", err)
+	}
+
+	expected := TLSConfig{
+		CAFile:             "/etc/ssl/loki-ca.pem",
+		CertFile:           "/etc/ssl/client.pem",
+		KeyFile:            "/etc/ssl/client-key.pem",
+		ServerName:         "loki.internal",
+		InsecureSkipVerify: true,
+	}
+	if cfg != expected {
+		t.Errorf("Expected %+v, got %+v", expected, cfg)
+	}
+}
+
+// TestTLSConfigFromEnv_InvalidBool tests that a malformed insecure flag is reported
+func TestTLSConfigFromEnv_InvalidBool(t *testing.T) {
+	t.Setenv(EnvLokiInsecureSkipVerify, "maybe")
+
+	if _, err := TLSConfigFromEnv(); err == nil || !strings.Contains(err.Error(), EnvLokiInsecureSkipVerify) {
+		t.Errorf("Expected invalid %s error, got %v", EnvLokiInsecureSkipVerify, err)
+	}
+}
+
+// TestTLSConfigBuild tests the resulting tls.Config and its error cases
+func TestTLSConfigBuild(t *testing.T) {
+	if tlsConfig, err := (TLSConfig{}).Build(); err != nil || tlsConfig != nil {
+		t.Errorf("Expected no tls.Config for empty settings, got %v, %v", tlsConfig, err)
+	}
+
+	tlsConfig, err := TLSConfig{ServerName: "loki.internal", InsecureSkipVerify: true}.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if tlsConfig.ServerName != "loki.internal" || !tlsConfig.InsecureSkipVerify {
+		t.Errorf("Unexpected tls.Config: %+v", tlsConfig)
+	}
+
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	errorCases := map[string]TLSConfig{
+		"failed to read CA file":         {CAFile: filepath.Join(dir, "missing.pem")},
+		"no certificates found":          {CAFile: notPEM},
+		"both a client certificate":      {CertFile: notPEM},
+		"failed to load client certific": {CertFile: notPEM, KeyFile: notPEM},
+	}
+	for expected, cfg := range errorCases {
+		if _, err := cfg.Build(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error containing %q for %+v, got %v", expected, cfg, err)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Bounds for the size of formatted query results
+const (
+	DefaultMaxOutputBytes = 50000
+	MinOutputBytes        = 1000
+	MaxOutputBytesLimit   = 1000000
+	DefaultMaxLineBytes   = 2000
+)
+
+// bytesPerToken approximates the size of a model token for max_tokens
+const bytesPerToken = 4
+
+// summaryReserve is the part of the output budget kept for the summary
+// appended to an elided result
+const summaryReserve = 400
+
+// Order in which log levels are listed in the summary
+var logLevels = []string{"fatal", "error", "warn", "info", "debug", "trace", "unknown"}
+
+// Label names that carry the level of a log stream
+var levelLabels = []string{"level", "detected_level", "severity", "lvl", "loglevel"}
+
+var (
+	// levelFieldPattern finds level=error, "level":"error" and similar fields
+	levelFieldPattern = regexp.MustCompile(`(?i)\b(?:level|lvl|severity|loglevel)["']?\s*[=:]\s*["']?([a-z]+)`)
+	// levelWordPattern finds upper-case levels such as ERROR or WARN
+	levelWordPattern = regexp.MustCompile(`\b(FATAL|PANIC|CRITICAL|ERROR|ERR|WARN|WARNING|INFO|DEBUG|TRACE)\b`)
+)
+
+// budgetOptions returns the schema options bounding the size of the result
+func budgetOptions() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithNumber("max_output_bytes",
+			mcp.Description(fmt.Sprintf("Maximum size of the result. Larger text results keep the first and last lines, elide the middle and end with a summary of lines, streams, time span and levels; other formats keep the first and last entries and add a note (default: %d, max: %d)", DefaultMaxOutputBytes, MaxOutputBytesLimit)),
+		),
+		mcp.WithNumber("max_tokens",
+			mcp.Description(fmt.Sprintf("Maximum size of the result in model tokens, estimated as %d bytes each; the smaller of max_tokens and max_output_bytes applies", bytesPerToken)),
+		),
+		mcp.WithNumber("max_line_bytes",
+			mcp.Description(fmt.Sprintf("Shorten log lines longer than this many bytes (default: %d)", DefaultMaxLineBytes)),
+		),
+	}
+}
+
+// outputBudgetFromRequest extracts the max_output_bytes, max_tokens and
+// max_line_bytes arguments, returning the output and line size limits
+func outputBudgetFromRequest(args map[string]any) (int, int) {
+	maxBytes := DefaultMaxOutputBytes
+	if bytesVal, ok := args["max_output_bytes"].(float64); ok && bytesVal > 0 {
+		maxBytes = int(math.Min(bytesVal, MaxOutputBytesLimit))
+	}
+	if tokensVal, ok := args["max_tokens"].(float64); ok && tokensVal > 0 {
+		maxBytes = min(maxBytes, int(math.Min(tokensVal*bytesPerToken, MaxOutputBytesLimit)))
+	}
+	maxBytes = max(maxBytes, MinOutputBytes)
+
+	maxLine := DefaultMaxLineBytes
+	if lineVal, ok := args["max_line_bytes"].(float64); ok && lineVal > 0 {
+		maxLine = int(math.Min(lineVal, float64(maxBytes)))
+	}
+	return maxBytes, maxLine
+}
+
+// truncateLine shortens a log line to the line size limit, cutting at a
+// rune boundary, and reports whether it was shortened
+func (o formatOptions) truncateLine(line string) (string, bool) {
+	if o.MaxLineBytes <= 0 || len(line) <= o.MaxLineBytes {
+		return line, false
+	}
+	cut := o.MaxLineBytes
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s… [%d more bytes]", line[:cut], len(line)-cut), true
+}
+
+// streamLine is a formatted log line and the index of its stream
+type streamLine struct {
+	stream int
+	text   string
+}
+
+// elideStreamLines renders as many of the first and last lines as fit in
+// budget bytes, with the stream headers they need, and replaces the rest
+// with a marker. It returns the rendered text and the number of lines elided.
+func elideStreamLines(lines []streamLine, headers []string, budget int) (string, int) {
+	half := budget / 2
+
+	// Take lines from the start while they fit in half of the budget
+	head, used, prev := 0, 0, -1
+	for head < len(lines) {
+		cost := len(lines[head].text) + 1
+		if lines[head].stream != prev {
+			cost += len(headers[lines[head].stream]) + 3
+		}
+		if used+cost > half {
+			break
+		}
+		used += cost
+		prev = lines[head].stream
+		head++
+	}
+
+	// and from the end while they fit in the rest
+	tail, used, next := len(lines), 0, -1
+	for tail > head {
+		line := lines[tail-1]
+		cost := len(line.text) + 1
+		if line.stream != next {
+			cost += len(headers[line.stream]) + len(" (continued)") + 3
+		}
+		if used+cost > budget-half {
+			break
+		}
+		used += cost
+		next = line.stream
+		tail--
+	}
+
+	var b strings.Builder
+	shown := make(map[int]bool)
+	writeLines := func(lines []streamLine) {
+		prev := -1
+		for _, line := range lines {
+			if line.stream != prev {
+				if prev != -1 {
+					b.WriteString("\n")
+				}
+				b.WriteString(headers[line.stream])
+				if shown[line.stream] {
+					b.WriteString(" (continued)")
+				}
+				b.WriteString(":\n")
+				shown[line.stream] = true
+				prev = line.stream
+			}
+			b.WriteString(line.text)
+			b.WriteString("\n")
+		}
+	}
+
+	writeLines(lines[:head])
+	elided := tail - head
+	if elided > 0 {
+		if head > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[... %d lines elided to fit the output budget ...]\n\n", elided)
+	}
+	writeLines(lines[tail:])
+	if tail < len(lines) {
+		b.WriteString("\n")
+	}
+	return b.String(), elided
+}
+
+// elideLines joins lines, each ending in a newline. If they do not fit in
+// budget bytes, only the first and last lines that fit are kept and the rest
+// is replaced with a marker. A budget of zero or less means unlimited. It
+// returns the text and the number of lines elided.
+func elideLines(lines []string, budget int) (string, int) {
+	size := 0
+	for _, line := range lines {
+		size += len(line) + 1
+	}
+	head, tail := len(lines), len(lines)
+	if budget > 0 && size > budget {
+		half := budget / 2
+		head, used := 0, 0
+		for head < len(lines) && used+len(lines[head])+1 <= half {
+			used += len(lines[head]) + 1
+			head++
+		}
+		tail, used = len(lines), 0
+		for tail > head && used+len(lines[tail-1])+1 <= budget-half {
+			used += len(lines[tail-1]) + 1
+			tail--
+		}
+		return joinElided(lines, head, tail), tail - head
+	}
+	return joinElided(lines, head, tail), 0
+}
+
+// joinElided joins lines[:head] and lines[tail:], each ending in a newline,
+// with a marker for the lines in between if there are any
+func joinElided(lines []string, head, tail int) string {
+	var b strings.Builder
+	for _, line := range lines[:head] {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	if tail > head {
+		fmt.Fprintf(&b, "[... %d lines elided to fit the output budget ...]\n", tail-head)
+	}
+	for _, line := range lines[tail:] {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// writeStreamLines writes every stream header, including those of streams
+// without lines, followed by the lines of the stream
+func writeStreamLines(b *strings.Builder, headers []string, lines []streamLine) {
+	next := 0
+	for i, header := range headers {
+		b.WriteString(header)
+		b.WriteString(":\n")
+		for next < len(lines) && lines[next].stream == i {
+			b.WriteString(lines[next].text)
+			b.WriteString("\n")
+			next++
+		}
+		b.WriteString("\n")
+	}
+}
+
+// streamSummary describes the lines, streams, time span and levels of a
+// streams result, along with what the output budget cut from the printed lines
+func streamSummary(streams []LokiEntry, opts formatOptions, printed, elided, shortened int) string {
+	total := 0
+	var first, last int64
+	counts := make(map[string]int)
+	for _, entry := range streams {
+		streamLevel := labelLevel(entry.Stream)
+		for _, val := range entry.Values {
+			if len(val) < 2 {
+				continue
+			}
+			total++
+			if ts, err := strconv.ParseInt(val[0], 10, 64); err == nil {
+				if first == 0 || ts < first {
+					first = ts
+				}
+				if ts > last {
+					last = ts
+				}
+			}
+			level := streamLevel
+			if level == "" {
+				level = lineLevel(val[1])
+			}
+			counts[level]++
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Summary: %d lines in %d streams", total, len(streams))
+	if first > 0 {
+		fmt.Fprintf(&b, " from %s to %s (%s)", formatNanosIn(first, opts.location()), formatNanosIn(last, opts.location()), formatSpan(time.Duration(last-first)))
+	}
+	var levels []string
+	for _, level := range logLevels {
+		if counts[level] > 0 {
+			levels = append(levels, fmt.Sprintf("%s=%d", level, counts[level]))
+		}
+	}
+	if len(levels) > 0 {
+		fmt.Fprintf(&b, "\nLevels: %s", strings.Join(levels, ", "))
+	}
+	b.WriteString(budgetNote(opts, printed, elided, shortened))
+	return b.String()
+}
+
+// budgetNote describes what the output budget cut, or returns "" if nothing was cut
+func budgetNote(opts formatOptions, printed, elided, shortened int) string {
+	var cuts []string
+	if elided > 0 {
+		cuts = append(cuts, fmt.Sprintf("%d of %d lines shown, the middle elided", printed-elided, printed))
+	}
+	if shortened > 0 {
+		cuts = append(cuts, fmt.Sprintf("%d lines longer than %d bytes shortened", shortened, opts.MaxLineBytes))
+	}
+	if len(cuts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nOutput limited to %d bytes: %s. Narrow the query or the time range, or raise max_output_bytes, to see everything", opts.MaxOutputBytes, strings.Join(cuts, "; "))
+}
+
+// limitQueryOutput applies the output budget to the machine-readable form of
+// a result: long lines are shortened, and if the entries or samples still do
+// not fit, only the first and last that fit are kept. The cost of each entry
+// is its JSON encoding with the labels of its stream, as in ndjson. The notes
+// and the summary are reserved twice, since the json format sends them both
+// in the summary and in the resource, so the whole tool result of every
+// format stays within the budget. It returns a note describing what was cut,
+// or "" if nothing was.
+func limitQueryOutput(output *QueryOutput, opts formatOptions) string {
+	if opts.MaxOutputBytes <= 0 {
+		return ""
+	}
+
+	budget := opts.MaxOutputBytes - 2*(summaryReserve+jsonSize(output.Notes)) - jsonSize(output.Range) -
+		len(`{"result_type":"streams","streams":[],"range":,"notes":[]}`)
+	var costs []int
+	shortened := 0
+	for i := range output.Streams {
+		stream := &output.Streams[i]
+		labels := jsonSize(stream.Labels)
+		budget -= labels + len(`{"labels":,"entries":[]},`)
+		for j := range stream.Entries {
+			entry := &stream.Entries[j]
+			line, cut := opts.truncateLine(entry.Line)
+			if cut {
+				entry.Line = line
+				shortened++
+			}
+			costs = append(costs, labels+jsonSize(entry)+1)
+		}
+	}
+	for _, series := range output.Series {
+		labels := jsonSize(series.Labels)
+		budget -= labels + len(`{"labels":,"samples":[]},`)
+		for _, sample := range series.Samples {
+			costs = append(costs, labels+jsonSize(sample)+1)
+		}
+	}
+
+	size := 0
+	for _, cost := range costs {
+		size += cost
+	}
+	head, tail := len(costs), len(costs)
+	if size > budget {
+		half, used := budget/2, 0
+		head = 0
+		for head < len(costs) && used+costs[head] <= half {
+			used += costs[head]
+			head++
+		}
+		tail, used = len(costs), 0
+		for tail > head && used+costs[tail-1] <= budget-half {
+			used += costs[tail-1]
+			tail--
+		}
+
+		// Drop the entries and samples between head and tail, keeping every
+		// stream and series so the labels of the result are complete
+		n := 0
+		keep := func() bool {
+			kept := n < head || n >= tail
+			n++
+			return kept
+		}
+		for i := range output.Streams {
+			entries := output.Streams[i].Entries[:0]
+			for _, entry := range output.Streams[i].Entries {
+				if keep() {
+					entries = append(entries, entry)
+				}
+			}
+			output.Streams[i].Entries = entries
+		}
+		for i := range output.Series {
+			samples := output.Series[i].Samples[:0]
+			for _, sample := range output.Series[i].Samples {
+				if keep() {
+					samples = append(samples, sample)
+				}
+			}
+			output.Series[i].Samples = samples
+		}
+	}
+
+	var cuts []string
+	if elided := tail - head; elided > 0 {
+		unit := "entries"
+		if output.Series != nil {
+			unit = "samples"
+		}
+		cuts = append(cuts, fmt.Sprintf("%d of %d %s kept, the middle %d elided", len(costs)-elided, len(costs), unit, elided))
+	}
+	if shortened > 0 {
+		cuts = append(cuts, fmt.Sprintf("%d lines longer than %d bytes shortened", shortened, opts.MaxLineBytes))
+	}
+	if len(cuts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Output limited to %d bytes: %s. Narrow the query or the time range, or raise max_output_bytes, to see everything", opts.MaxOutputBytes, strings.Join(cuts, "; "))
+}
+
+// jsonSize returns the size of the JSON encoding of v
+func jsonSize(v any) int {
+	data, _ := json.Marshal(v)
+	return len(data)
+}
+
+// labelLevel returns the normalized level of a stream from its labels, or ""
+// if it has no level label
+func labelLevel(labels map[string]string) string {
+	for _, name := range levelLabels {
+		if value, ok := labels[name]; ok && value != "" {
+			return normalizeLevel(value)
+		}
+	}
+	return ""
+}
+
+// lineLevel detects the level of a log line from a level field such as
+// level=error, or an upper-case level word such as ERROR
+func lineLevel(line string) string {
+	if m := levelFieldPattern.FindStringSubmatch(line); m != nil {
+		return normalizeLevel(m[1])
+	}
+	if m := levelWordPattern.FindStringSubmatch(line); m != nil {
+		return normalizeLevel(m[1])
+	}
+	return "unknown"
+}
+
+// normalizeLevel maps the many spellings of log levels to those in logLevels
+func normalizeLevel(level string) string {
+	switch strings.ToLower(level) {
+	case "fatal", "panic", "critical", "crit", "emerg", "emergency", "alert":
+		return "fatal"
+	case "error", "err", "eror":
+		return "error"
+	case "warn", "warning":
+		return "warn"
+	case "info", "information", "informational", "notice":
+		return "info"
+	case "debug", "dbug":
+		return "debug"
+	case "trace":
+		return "trace"
+	default:
+		return "unknown"
+	}
+}
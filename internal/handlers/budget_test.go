@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// budgetTestStreams returns an error stream and an unlabelled stream with
+// count lines each, one second apart
+func budgetTestStreams(count int) []LokiEntry {
+	errors := LokiEntry{Stream: map[string]string{"app": "api", "level": "error"}}
+	other := LokiEntry{Stream: map[string]string{"app": "web"}}
+	for i := 0; i < count; i++ {
+		ts := fmt.Sprintf("%d", int64(1705312800+i)*1000000000)
+		errors.Values = append(errors.Values, []string{ts, fmt.Sprintf("request %d failed: connection refused by upstream", i)})
+		line := fmt.Sprintf(`level=info msg="request %d served"`, i)
+		if i%2 == 1 {
+			line = fmt.Sprintf("request %d served", i)
+		}
+		other.Values = append(other.Values, []string{ts, line})
+	}
+	return []LokiEntry{errors, other}
+}
+
+// TestFormatStreamResults_Budget tests that a result over the output budget keeps its first and last lines and ends with a summary
+func TestFormatStreamResults_Budget(t *testing.T) {
+	opts := formatOptions{MaxOutputBytes: 4000, MaxLineBytes: DefaultMaxLineBytes}
+	output := formatStreamResults(budgetTestStreams(200), opts)
+
+	if len(output) > opts.MaxOutputBytes {
+		t.Errorf("Expected at most %d bytes, got %d", opts.MaxOutputBytes, len(output))
+	}
+	for _, expected := range []string{
+		"Found 2 streams:\n\nStream (app=api, level=error) 1:\n[2024-01-15T10:00:00Z] request 0 failed",
+		"lines elided to fit the output budget ...]\n\nStream (app=web) 2:\n",
+		"[2024-01-15T10:03:19Z] request 199 served\n\nSummary: 400 lines in 2 streams from 2024-01-15T10:00:00Z to 2024-01-15T10:03:19Z (3m19s)\n",
+		"Levels: error=200, info=100, unknown=100\n",
+		"Output limited to 4000 bytes: ",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+
+	// Unbounded and small results are unchanged
+	if strings.Contains(formatStreamResults(budgetTestStreams(200), formatOptions{}), "Summary:") {
+		t.Error("Expected no summary without a budget")
+	}
+	if strings.Contains(formatStreamResults(budgetTestStreams(2), opts), "Summary:") {
+		t.Error("Expected no summary for a result within the budget")
+	}
+}
+
+// TestFormatStreamResults_BudgetContinued tests that a stream split by the elision repeats its header
+func TestFormatStreamResults_BudgetContinued(t *testing.T) {
+	streams := budgetTestStreams(200)[:1]
+	output := formatStreamResults(streams, formatOptions{MaxOutputBytes: 2000})
+
+	if !strings.Contains(output, "lines elided to fit the output budget ...]\n\nStream (app=api, level=error) 1 (continued):\n") {
+		t.Errorf("Expected a continued stream header, got:\n%s", output)
+	}
+	if !strings.Contains(output, "Levels: error=200\n") {
+		t.Errorf("Expected levels from the stream label, got:\n%s", output)
+	}
+}
+
+// TestFormatResults_LargeBudget tests that large results are formatted quickly and kept within the budget
+func TestFormatResults_LargeBudget(t *testing.T) {
+	opts := formatOptions{MaxOutputBytes: DefaultMaxOutputBytes, MaxLineBytes: DefaultMaxLineBytes}
+	streams := budgetTestStreams(50000)
+	metric := LokiMetric{Metric: map[string]string{"app": "api"}}
+	for i := 0; i < 100000; i++ {
+		metric.Values = append(metric.Values, LokiSample{Timestamp: float64(1705312800 + i), Value: "1"})
+	}
+
+	started := time.Now()
+	output := formatStreamResults(streams, opts)
+	if len(output) > opts.MaxOutputBytes || !strings.Contains(output, "Summary: 100000 lines in 2 streams") {
+		t.Errorf("Expected a summary within %d bytes, got %d bytes", opts.MaxOutputBytes, len(output))
+	}
+	output = formatMetricResults([]LokiMetric{metric}, opts)
+	if len(output) > opts.MaxOutputBytes || !strings.Contains(output, "Summary: 100000 samples in 1 series") {
+		t.Errorf("Expected a summary within %d bytes, got %d bytes", opts.MaxOutputBytes, len(output))
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Expected large results to be formatted in linear time, took %s", elapsed)
+	}
+}
+
+// TestTruncateLine tests that long lines are cut at a rune boundary
+func TestTruncateLine(t *testing.T) {
+	opts := formatOptions{MaxLineBytes: 5}
+
+	if line, cut := opts.truncateLine("short"); cut || line != "short" {
+		t.Errorf("Expected short line unchanged, got %q", line)
+	}
+	if line, cut := opts.truncateLine("abcdéfgh"); !cut || line != "abcd… [5 more bytes]" {
+		t.Errorf("Expected line cut before the é, got %q", line)
+	}
+	if line, cut := (formatOptions{}).truncateLine(strings.Repeat("x", 10000)); cut || len(line) != 10000 {
+		t.Error("Expected no truncation without a limit")
+	}
+}
+
+// TestLineLevel tests level detection from logfmt, JSON and plain text lines
+func TestLineLevel(t *testing.T) {
+	tests := map[string]string{
+		`ts=1 level=error msg="boom"`:             "error",
+		`{"level":"WARNING","msg":"slow"}`:        "warn",
+		`lvl=dbug msg=x`:                          "debug",
+		`2024-01-15 10:00:00 INFO server started`: "info",
+		`panic: FATAL runtime error`:              "fatal",
+		`nothing to see here`:                     "unknown",
+	}
+	for line, expected := range tests {
+		if level := lineLevel(line); level != expected {
+			t.Errorf("lineLevel(%q) = %q, expected %q", line, level, expected)
+		}
+	}
+}
+
+// TestOutputBudgetFromRequest tests the defaults and bounds of the budget arguments
+func TestOutputBudgetFromRequest(t *testing.T) {
+	tests := []struct {
+		args             map[string]any
+		maxBytes, maxLen int
+	}{
+		{map[string]any{}, DefaultMaxOutputBytes, DefaultMaxLineBytes},
+		{map[string]any{"max_output_bytes": float64(20000), "max_tokens": float64(1000)}, 4000, DefaultMaxLineBytes},
+		{map[string]any{"max_tokens": float64(100000)}, DefaultMaxOutputBytes, DefaultMaxLineBytes},
+		{map[string]any{"max_output_bytes": float64(10)}, MinOutputBytes, DefaultMaxLineBytes},
+		{map[string]any{"max_output_bytes": float64(1e9), "max_line_bytes": float64(300)}, MaxOutputBytesLimit, 300},
+	}
+	for _, test := range tests {
+		maxBytes, maxLen := outputBudgetFromRequest(test.args)
+		if maxBytes != test.maxBytes || maxLen != test.maxLen {
+			t.Errorf("outputBudgetFromRequest(%v) = %d, %d, expected %d, %d", test.args, maxBytes, maxLen, test.maxBytes, test.maxLen)
+		}
+	}
+}
+
+// TestHandleLokiQuery_MaxLineBytes tests that loki_query shortens long lines and reports it
+func TestHandleLokiQuery_MaxLineBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"streams","result":[
+			{"stream":{"app":"api"},"values":[["1705312800000000000","%s"]]}
+		]}}`, strings.Repeat("x", 500))
+	}))
+	defer server.Close()
+
+	result, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query":          `{app="api"}`,
+		"url":            server.URL,
+		"start":          "2024-01-15T10:00:00Z",
+		"end":            "2024-01-15T11:00:00Z",
+		"max_line_bytes": float64(100),
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+
+	text := resultText(t, result)
+	if !strings.Contains(text, strings.Repeat("x", 100)+"… [400 more bytes]\n") ||
+		!strings.Contains(text, "1 lines longer than 100 bytes shortened") {
+		t.Errorf("Expected a shortened line, got:\n%s", text)
+	}
+}
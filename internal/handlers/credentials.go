@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
+)
+
+// credentialArguments are tool argument names that carry secrets
+var credentialArguments = map[string]bool{
+	"username":      true,
+	"user":          true,
+	"password":      true,
+	"passwd":        true,
+	"token":         true,
+	"access_token":  true,
+	"bearer_token":  true,
+	"api_token":     true,
+	"api_key":       true,
+	"apikey":        true,
+	"secret":        true,
+	"client_secret": true,
+	"authorization": true,
+	"auth":          true,
+	"basic_auth":    true,
+	"credentials":   true,
+}
+
+// serverSideCredentials reports whether credentials are only resolved
+// server-side, as enabled in the config file or the environment
+func serverSideCredentials() (bool, error) {
+	if cfg := currentConfig(); cfg != nil && cfg.ServerSideCredentials {
+		return true, nil
+	}
+	return config.ServerSideCredentialsFromEnv()
+}
+
+// rejectCredentialArguments returns an error if any tool argument looks like
+// a credential, including a URL with an embedded password
+func rejectCredentialArguments(args map[string]any) error {
+	for name := range args {
+		normalized := strings.ToLower(strings.ReplaceAll(name, "-", "_"))
+		if credentialArguments[normalized] || strings.Contains(normalized, "password") || strings.Contains(normalized, "secret") {
+			return fmt.Errorf("credentials must not be passed as tool arguments (got %q); configure them server-side with environment variables, secret files or the datasource config file", name)
+		}
+	}
+
+	if urlArg, ok := args["url"].(string); ok && urlArg != "" {
+		if u, err := url.Parse(urlArg); err == nil && u.User != nil {
+			return fmt.Errorf("credentials must not be embedded in the url argument; configure them server-side with environment variables, secret files or the datasource config file")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
+)
+
+// The server-side configuration shared by all Loki tools
+var (
+	serverConfigMu sync.RWMutex
+	serverConfig   *config.Config
+)
+
+// SetConfig installs the server-side configuration used by all Loki tools.
+// Call it before creating the tools so their schemas list the configured
+// datasources.
+func SetConfig(cfg *config.Config) {
+	serverConfigMu.Lock()
+	defer serverConfigMu.Unlock()
+	serverConfig = cfg
+}
+
+// currentConfig returns the server-side configuration, or nil if none is set
+func currentConfig() *config.Config {
+	serverConfigMu.RLock()
+	defer serverConfigMu.RUnlock()
+	return serverConfig
+}
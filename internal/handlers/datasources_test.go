@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
+)
+
+// useConfig installs a server-side configuration for the duration of a test
+func useConfig(t *testing.T, cfg *config.Config) {
+	t.Helper()
+	SetConfig(cfg)
+	t.Cleanup(func() { SetConfig(nil) })
+}
+
+// recordingLokiServer records the last request it received and answers with an empty result
+func recordingLokiServer(t *testing.T, last **http.Request) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*last = r
+		w.Write([]byte(lokiEmptyResponse))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestLokiQuery_Datasources tests that the datasource argument selects the URL, tenant, credentials and limits of a profile
+func TestLokiQuery_Datasources(t *testing.T) {
+	var prodRequest, stagingRequest *http.Request
+	prod := recordingLokiServer(t, &prodRequest)
+	staging := recordingLokiServer(t, &stagingRequest)
+
+	useConfig(t, &config.Config{
+		DefaultDatasource: "prod",
+		Datasources: []config.Datasource{
+			{Name: "prod", URL: prod.URL, OrgID: "platform", Token: "prod-token", DefaultLimit: 250, MaxLimit: 500},
+			{Name: "staging", URL: staging.URL, Username: "admin", Password: "secret"},
+		},
+	})
+
+	// The default datasource is used when none is selected
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`})); err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if prodRequest == nil {
+		t.Fatalf("Expected the default datasource to be queried")
+	}
+	if prodRequest.Header.Get("Authorization") != "Bearer prod-token" || prodRequest.Header.Get("X-Scope-OrgID") != "platform" {
+		t.Errorf("Unexpected headers for prod: %v", prodRequest.Header)
+	}
+	if limit := prodRequest.URL.Query().Get("limit"); limit != "250" {
+		t.Errorf("Expected the datasource default limit 250, got %s", limit)
+	}
+
+	// Limits requested by the model are capped at the datasource maximum
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`, "limit": float64(5000)})); err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if limit := prodRequest.URL.Query().Get("limit"); limit != "500" {
+		t.Errorf("Expected the limit to be capped at 500, got %s", limit)
+	}
+
+	// Another datasource can be selected by name
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`, "datasource": "staging"})); err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if stagingRequest == nil {
+		t.Fatalf("Expected the staging datasource to be queried")
+	}
+	if user, pass, ok := stagingRequest.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+		t.Errorf("Expected basic auth for staging, got %s/%s", user, pass)
+	}
+}
+
+// TestLokiQuery_DatasourceErrors tests invalid datasource selections
+func TestLokiQuery_DatasourceErrors(t *testing.T) {
+	testCases := map[string]map[string]any{
+		`unknown datasource "dev"`:           {"query": `{app="api"}`, "datasource": "dev"},
+		"url and datasource cannot be combi": {"query": `{app="api"}`, "datasource": "prod", "url": "http://other:3100"},
+	}
+
+	useConfig(t, &config.Config{Datasources: []config.Datasource{{Name: "prod", URL: "http://prod:3100"}}})
+	for expected, args := range testCases {
+		if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(args)); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error containing %q, got %v", expected, err)
+		}
+	}
+
+	// Without a config file, selecting a datasource is an error too
+	SetConfig(nil)
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`, "datasource": "prod"})); err == nil || !strings.Contains(err.Error(), "no datasources are configured") {
+		t.Errorf("Expected no datasources error, got %v", err)
+	}
+}
+
+// TestLokiConnectionOptions_Datasource tests that the tool schema lists configured datasources
+func TestLokiConnectionOptions_Datasource(t *testing.T) {
+	if _, ok := NewLokiQueryTool().InputSchema.Properties["datasource"]; ok {
+		t.Errorf("Expected no datasource argument without a config")
+	}
+
+	useConfig(t, &config.Config{
+		DefaultDatasource: "prod",
+		Datasources: []config.Datasource{
+			{Name: "staging", URL: "http://staging:3100"},
+			{Name: "prod", URL: "http://prod:3100"},
+		},
+	})
+
+	property, ok := NewLokiQueryTool().InputSchema.Properties["datasource"].(map[string]any)
+	if !ok {
+		t.Fatalf("Expected a datasource argument in the tool schema")
+	}
+	if enum, _ := property["enum"].([]string); strings.Join(enum, ",") != "prod,staging" {
+		t.Errorf("Unexpected datasource enum: %v", property["enum"])
+	}
+	if description, _ := property["description"].(string); !strings.Contains(description, "default: prod") {
+		t.Errorf("Unexpected datasource description: %s", description)
+	}
+}
+
+// TestLokiQuery_DatasourceHeaders tests that static headers are sent but do not override tenant or authentication
+func TestLokiQuery_DatasourceHeaders(t *testing.T) {
+	var last *http.Request
+	loki := recordingLokiServer(t, &last)
+
+	t.Setenv("LOKI_MCP_TEST_ROUTE", "eu-west")
+	useConfig(t, &config.Config{
+		Datasources: []config.Datasource{{
+			Name:  "prod",
+			URL:   loki.URL,
+			OrgID: "platform",
+			Token: "prod-token",
+			Headers: map[string]config.HeaderValue{
+				"X-Grafana-Org-Id": {Value: "2"},
+				"X-Route":          {Env: "LOKI_MCP_TEST_ROUTE"},
+				"X-Scope-OrgID":    {Value: "other"},
+			},
+		}},
+	})
+
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`})); err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if last.Header.Get("X-Grafana-Org-Id") != "2" || last.Header.Get("X-Route") != "eu-west" {
+		t.Errorf("Expected the static headers, got %v", last.Header)
+	}
+	if last.Header.Get("X-Scope-OrgID") != "platform" || last.Header.Get("Authorization") != "Bearer prod-token" {
+		t.Errorf("Expected tenant and authentication to take precedence, got %v", last.Header)
+	}
+
+	// Headers are configured server-side only
+	if _, ok := NewLokiQueryTool().InputSchema.Properties["headers"]; ok {
+		t.Errorf("Expected no headers argument in the tool schema")
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Modes of collapsing repeated log lines
+const (
+	// DedupOff prints every line
+	DedupOff = "off"
+	// DedupExact collapses identical lines
+	DedupExact = "exact"
+	// DedupNormalized collapses lines that differ only in numbers, UUIDs,
+	// IP addresses, hex values or timestamps
+	DedupNormalized = "normalized"
+)
+
+var dedupModes = []string{DedupOff, DedupExact, DedupNormalized}
+
+// Patterns replaced by placeholders when normalizing a log line, in the
+// order they are applied, so timestamps and UUIDs are replaced before the
+// numbers they contain
+var normalizePatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`), "<ts>"},
+	{regexp.MustCompile(`\b\d{2}:\d{2}:\d{2}(?:[.,]\d+)?`), "<ts>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}(?::\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{1,4}(?:::?[0-9a-f]{1,4}){2,7}\b`), "<ip>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b`), "<hex>"},
+}
+
+var (
+	// hexPattern finds hex strings such as hashes and trace IDs, which are
+	// only replaced if they mix digits and letters
+	hexPattern = regexp.MustCompile(`(?i)\b[0-9a-f]{8,}\b`)
+	// numberPattern finds the numbers left after the other patterns
+	numberPattern = regexp.MustCompile(`\d+(?:\.\d+)?`)
+)
+
+// dedupOption returns the schema option selecting how repeated lines are collapsed
+func dedupOption() mcp.ToolOption {
+	return mcp.WithString("dedup",
+		mcp.Description("Collapse repeated log lines into one line with a count and the first and last time seen: exact groups identical lines, normalized also groups lines that differ only in numbers, UUIDs, IP addresses, hex values or timestamps (default: off)"),
+		mcp.Enum(dedupModes...),
+	)
+}
+
+// dedupFromRequest returns the dedup argument, defaulting to off
+func dedupFromRequest(args map[string]any) (string, error) {
+	mode, ok := args["dedup"].(string)
+	if !ok || mode == "" {
+		return DedupOff, nil
+	}
+	mode = strings.ToLower(mode)
+	for _, m := range dedupModes {
+		if mode == m {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("invalid dedup %q: must be one of %s", mode, strings.Join(dedupModes, ", "))
+}
+
+// normalizeLine replaces the variable parts of a log line with placeholders
+func normalizeLine(line string) string {
+	for _, p := range normalizePatterns {
+		line = p.pattern.ReplaceAllString(line, p.replacement)
+	}
+	line = hexPattern.ReplaceAllStringFunc(line, func(s string) string {
+		if strings.IndexFunc(s, unicode.IsDigit) < 0 || strings.IndexFunc(s, unicode.IsLetter) < 0 {
+			return s
+		}
+		return "<hex>"
+	})
+	return numberPattern.ReplaceAllString(line, "<num>")
+}
+
+// lineGroup is a log line and the repeats of it collapsed by dedup
+type lineGroup struct {
+	// line is the first line of the group in result order, and ts its own
+	// raw timestamp
+	line, ts string
+	count    int
+	// first and last are the raw timestamps of the earliest and latest line
+	first, last string
+}
+
+// dedupLines groups the [timestamp, line] values of a stream by the dedup
+// mode, in the order each group first appears. With DedupOff every line is
+// its own group.
+func dedupLines(values [][]string, mode string) []lineGroup {
+	groups := make([]lineGroup, 0, len(values))
+	index := make(map[string]int)
+	for _, val := range values {
+		if len(val) < 2 {
+			continue
+		}
+
+		key := val[1]
+		switch mode {
+		case DedupExact:
+		case DedupNormalized:
+			key = normalizeLine(val[1])
+		default:
+			groups = append(groups, lineGroup{line: val[1], ts: val[0], count: 1, first: val[0], last: val[0]})
+			continue
+		}
+
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(groups)
+			groups = append(groups, lineGroup{line: val[1], ts: val[0], count: 1, first: val[0], last: val[0]})
+			continue
+		}
+		group := &groups[i]
+		group.count++
+		if timestampBefore(val[0], group.first) {
+			group.first = val[0]
+		}
+		if timestampBefore(group.last, val[0]) {
+			group.last = val[0]
+		}
+	}
+	return groups
+}
+
+// collapsedNote describes how many lines of streams dedup collapsed into
+// groups, or returns "" if it collapsed none
+func collapsedNote(streams []LokiEntry, groups int, mode string) string {
+	total := 0
+	for _, entry := range streams {
+		for _, val := range entry.Values {
+			if len(val) >= 2 {
+				total++
+			}
+		}
+	}
+	if groups >= total {
+		return ""
+	}
+	return fmt.Sprintf("Collapsed %d lines into %d with dedup %s", total, groups, mode)
+}
+
+// timestampBefore reports whether nanosecond timestamp a is before b
+func timestampBefore(a, b string) bool {
+	na, errA := strconv.ParseInt(a, 10, 64)
+	nb, errB := strconv.ParseInt(b, 10, 64)
+	if errA != nil || errB != nil {
+		return a < b
+	}
+	return na < nb
+}
+
+// formatEntryTime formats a nanosecond timestamp from Loki in loc, or
+// returns it unchanged if it is not a number
+func formatEntryTime(raw string, loc *time.Location) string {
+	// Parse timestamp as an integer, since a float64 cannot hold
+	// nanosecond precision
+	ts, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return raw
+	}
+	// Convert to time - Loki returns timestamps in nanoseconds already
+	return formatNanosIn(ts, loc)
+}
+
+// format renders the group as a log line with its times in loc, prefixed
+// for repeated lines with the count and the time range they were seen in
+func (g lineGroup) format(line string, loc *time.Location) string {
+	if g.count == 1 {
+		return fmt.Sprintf("[%s] %s", formatEntryTime(g.first, loc), line)
+	}
+	return fmt.Sprintf("[%s .. %s] (%d lines) %s", formatEntryTime(g.first, loc), formatEntryTime(g.last, loc), g.count, line)
+}
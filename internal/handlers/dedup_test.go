@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// dedupTestStreams is a crash loop repeating the same lines with different
+// request IDs, newest first as Loki returns them
+var dedupTestStreams = []LokiEntry{
+	{Stream: map[string]string{"app": "api"}, Values: [][]string{
+		{"1705312830000000000", "panic: connection refused to 10.0.0.7:5432"},
+		{"1705312820000000000", "request 7d1f0c2e-4b1a-4f8e-9a51-3c2d1e0f9b8a took 31ms"},
+		{"1705312810000000000", "panic: connection refused to 10.0.0.7:5432"},
+		{"1705312805000000000", "request 0b6e9c1d-2f3a-4d5e-8f90-1a2b3c4d5e6f took 1250ms"},
+		{"1705312800000000000", "panic: connection refused to 10.0.0.9:5432"},
+	}},
+}
+
+// TestFormatStreamResults_DedupExact tests that identical lines are collapsed with a count and time range
+func TestFormatStreamResults_DedupExact(t *testing.T) {
+	output := formatStreamResults(dedupTestStreams, formatOptions{Dedup: DedupExact})
+
+	expected := "Found 1 streams:\n\n" +
+		"Stream (app=api) 1:\n" +
+		"[2024-01-15T10:00:10Z .. 2024-01-15T10:00:30Z] (2 lines) panic: connection refused to 10.0.0.7:5432\n" +
+		"[2024-01-15T10:00:20Z] request 7d1f0c2e-4b1a-4f8e-9a51-3c2d1e0f9b8a took 31ms\n" +
+		"[2024-01-15T10:00:05Z] request 0b6e9c1d-2f3a-4d5e-8f90-1a2b3c4d5e6f took 1250ms\n" +
+		"[2024-01-15T10:00:00Z] panic: connection refused to 10.0.0.9:5432\n\n" +
+		"Collapsed 5 lines into 4 with dedup exact"
+	if output != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, output)
+	}
+}
+
+// TestFormatStreamResults_DedupNormalized tests that lines differing only in variable parts are collapsed
+func TestFormatStreamResults_DedupNormalized(t *testing.T) {
+	output := formatStreamResults(dedupTestStreams, formatOptions{Dedup: DedupNormalized})
+
+	expected := "Found 1 streams:\n\n" +
+		"Stream (app=api) 1:\n" +
+		"[2024-01-15T10:00:00Z .. 2024-01-15T10:00:30Z] (3 lines) panic: connection refused to 10.0.0.7:5432\n" +
+		"[2024-01-15T10:00:05Z .. 2024-01-15T10:00:20Z] (2 lines) request 7d1f0c2e-4b1a-4f8e-9a51-3c2d1e0f9b8a took 31ms\n\n" +
+		"Collapsed 5 lines into 2 with dedup normalized"
+	if output != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, output)
+	}
+
+	// Without dedup every line is printed
+	if output := formatStreamResults(dedupTestStreams, formatOptions{}); strings.Contains(output, "Collapsed") || strings.Count(output, "\n[") != 5 {
+		t.Errorf("Expected every line without dedup, got:\n%s", output)
+	}
+}
+
+// TestNormalizeLine tests the placeholders for the variable parts of log lines
+func TestNormalizeLine(t *testing.T) {
+	tests := map[string]string{
+		"2024-01-15T10:00:00.123Z GET /users/42 200 in 3.5ms":             "<ts> GET /users/<num> <num> in <num>ms",
+		"trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span=00f067aa0ba902b7": "trace_id=<hex> span=<hex>",
+		"user 7d1f0c2e-4b1a-4f8e-9a51-3c2d1e0f9b8a from 192.168.1.10":     "user <uuid> from <ip>",
+		"dial tcp [2001:db8:85a3::8a2e:370:7334]:443: timeout":            "dial tcp [<ip>]:<num>: timeout",
+		"ptr=0xc000123abc at 10:15:01 failed":                             "ptr=<hex> at <ts> failed",
+		"connection reset by peer":                                        "connection reset by peer",
+	}
+	for line, expected := range tests {
+		if normalized := normalizeLine(line); normalized != expected {
+			t.Errorf("normalizeLine(%q) = %q, expected %q", line, normalized, expected)
+		}
+	}
+}
+
+// TestHandleLokiQuery_Dedup tests the dedup argument of loki_query
+func TestHandleLokiQuery_Dedup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[
+			{"stream":{"app":"api"},"values":[["1705312810000000000","boom"],["1705312800000000000","boom"]]}
+		]}}`))
+	}))
+	defer server.Close()
+
+	args := map[string]any{
+		"query": `{app="api"}`,
+		"url":   server.URL,
+		"start": "2024-01-15T10:00:00Z",
+		"end":   "2024-01-15T11:00:00Z",
+		"dedup": "exact",
+	}
+	result, err := HandleLokiQuery(context.Background(), newCallToolRequest(args))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if text := resultText(t, result); !strings.Contains(text, "[2024-01-15T10:00:00Z .. 2024-01-15T10:00:10Z] (2 lines) boom\n") {
+		t.Errorf("Expected collapsed lines, got:\n%s", text)
+	}
+
+	// Formats other than text collapse the entries and note it
+	args["output_format"] = "json"
+	result, err = HandleLokiQuery(context.Background(), newCallToolRequest(args))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if text := resultText(t, result); !strings.HasPrefix(text, "Found 1 streams with 1 entries.") || !strings.Contains(text, "Collapsed 2 lines into 1 with dedup exact") {
+		t.Errorf("Expected a collapsed json result, got:\n%s", text)
+	}
+	delete(args, "output_format")
+
+	args["dedup"] = "fuzzy"
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(args)); err == nil || !strings.Contains(err.Error(), "invalid dedup") {
+		t.Errorf("Expected dedup error, got %v", err)
+	}
+}
+
+// TestFormatQueryOutput_Dedup tests that dedup collapses the entries of the machine-readable formats
+func TestFormatQueryOutput_Dedup(t *testing.T) {
+	result := &LokiResult{Data: LokiData{ResultType: ResultTypeStreams, Result: dedupTestStreams}}
+	output := newQueryOutput(result, DedupNormalized)
+
+	entries := output.Streams[0].Entries
+	expected := EntryOutput{
+		Timestamp:   "2024-01-15T10:00:30Z",
+		TimestampNs: "1705312830000000000",
+		Line:        "panic: connection refused to 10.0.0.7:5432",
+		Count:       3,
+		FirstSeen:   "2024-01-15T10:00:00Z",
+		LastSeen:    "2024-01-15T10:00:30Z",
+	}
+	if len(entries) != 2 || entries[0] != expected || entries[1].Count != 2 {
+		t.Errorf("Expected 2 collapsed entries, got %+v", entries)
+	}
+	// Each entry keeps the timestamp of its own line, so it selects a line that exists in Loki
+	for _, entry := range entries {
+		found := false
+		for _, val := range dedupTestStreams[0].Values {
+			found = found || (val[0] == entry.TimestampNs && val[1] == entry.Line)
+		}
+		if !found {
+			t.Errorf("Expected entry %+v to match a line of the result", entry)
+		}
+	}
+	if note := collapsedNote(dedupTestStreams, output.entries(), DedupNormalized); note != "Collapsed 5 lines into 2 with dedup normalized" {
+		t.Errorf("Unexpected note: %q", note)
+	}
+
+	csvOutput, err := formatQueryOutput(output, OutputFormatCSV, formatOptions{})
+	if err != nil {
+		t.Fatalf("csv failed: %v", err)
+	}
+	if !strings.HasPrefix(csvOutput, "timestamp,timestamp_ns,labels,line,count,first_seen,last_seen\n"+
+		`2024-01-15T10:00:30Z,1705312830000000000,"{app=""api""}",panic: connection refused to 10.0.0.7:5432,3,2024-01-15T10:00:00Z,2024-01-15T10:00:30Z`+"\n") {
+		t.Errorf("Unexpected csv:\n%s", csvOutput)
+	}
+
+	markdown, err := formatQueryOutput(output, OutputFormatMarkdown, formatOptions{})
+	if err != nil {
+		t.Fatalf("markdown failed: %v", err)
+	}
+	if !strings.Contains(markdown, "| First seen | Last seen | Count | Line |\n| --- | --- | --- | --- |\n"+
+		"| 2024-01-15T10:00:00Z | 2024-01-15T10:00:30Z | 3 | panic: connection refused to 10.0.0.7:5432 |\n") {
+		t.Errorf("Unexpected markdown:\n%s", markdown)
+	}
+
+	ndjson, err := formatQueryOutput(output, OutputFormatNDJSON, formatOptions{})
+	if err != nil {
+		t.Fatalf("ndjson failed: %v", err)
+	}
+	if !strings.Contains(ndjson, `"count":3,"first_seen":"2024-01-15T10:00:00Z","last_seen":"2024-01-15T10:00:30Z"}`) {
+		t.Errorf("Unexpected ndjson:\n%s", ndjson)
+	}
+
+	// Without dedup the entries have no group fields
+	if entry := newQueryOutput(result, DedupOff).Streams[0].Entries[0]; entry.Count != 0 || entry.FirstSeen != "" {
+		t.Errorf("Expected a plain entry without dedup, got %+v", entry)
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// LokiDetectedFieldsResult represents the response of the Loki detected_fields endpoint
+type LokiDetectedFieldsResult struct {
+	Fields []LokiDetectedField `json:"fields"`
+	Limit  int                 `json:"limit,omitempty"`
+}
+
+// LokiDetectedField represents a structured metadata or parsed field detected in log lines
+type LokiDetectedField struct {
+	Label       string   `json:"label"`
+	Type        string   `json:"type"`
+	Cardinality uint64   `json:"cardinality"`
+	Parsers     []string `json:"parsers"`
+}
+
+// LokiDetectedLabelsResult represents the response of the Loki detected_labels endpoint
+type LokiDetectedLabelsResult struct {
+	DetectedLabels []LokiDetectedLabel `json:"detectedLabels"`
+}
+
+// LokiDetectedLabel represents a stream label detected for a selector
+type LokiDetectedLabel struct {
+	Label       string `json:"label"`
+	Cardinality uint64 `json:"cardinality"`
+}
+
+// NewLokiDetectedFieldsTool creates and returns a tool for discovering fields in log lines
+func NewLokiDetectedFieldsTool() mcp.Tool {
+	options := []mcp.ToolOption{
+		mcp.WithDescription("List the fields Grafana Loki detected in the log lines of a stream selector, including structured metadata and fields parsed from JSON or logfmt, with their type and cardinality"),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("LogQL stream selector, e.g. {app=\"api\"}"),
+		),
+	}
+	options = append(options, lokiConnectionOptions()...)
+	options = append(options,
+		mcp.WithString("start",
+			mcp.Description("Start time for the lookup (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the lookup (default: now)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of fields to return (default: chosen by Loki)"),
+		),
+		mcp.WithNumber("line_limit",
+			mcp.Description("Maximum number of log lines to sample for fields (default: chosen by Loki)"),
+		),
+	)
+
+	return mcp.NewTool("loki_detected_fields", options...)
+}
+
+// NewLokiDetectedLabelsTool creates and returns a tool for discovering the labels of a stream selector
+func NewLokiDetectedLabelsTool() mcp.Tool {
+	options := []mcp.ToolOption{
+		mcp.WithDescription("List the stream labels Grafana Loki detected for a stream selector, with their cardinality"),
+		mcp.WithString("query",
+			mcp.Description("LogQL stream selector, e.g. {app=\"api\"} (default: all streams)"),
+		),
+	}
+	options = append(options, lokiConnectionOptions()...)
+	options = append(options,
+		mcp.WithString("start",
+			mcp.Description("Start time for the lookup (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the lookup (default: now)"),
+		),
+	)
+
+	return mcp.NewTool("loki_detected_labels", options...)
+}
+
+// HandleLokiDetectedFields handles Loki detected fields tool requests
+func HandleLokiDetectedFields(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.Params.Arguments
+	query, ok := args["query"].(string)
+	if !ok || query == "" {
+		return nil, fmt.Errorf("query parameter is required")
+	}
+	conn, err := lokiConnectionFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, err := conn.timeRangeFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", strconv.FormatInt(start, 10))
+	params.Set("end", strconv.FormatInt(end, 10))
+	if limitVal, ok := args["limit"].(float64); ok && limitVal > 0 {
+		params.Set("limit", strconv.Itoa(int(limitVal)))
+	}
+	if lineLimitVal, ok := args["line_limit"].(float64); ok && lineLimitVal > 0 {
+		params.Set("line_limit", strconv.Itoa(int(lineLimitVal)))
+	}
+
+	fieldsURL, err := buildLokiURL(conn.URL, "detected_fields", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query URL: %v", err)
+	}
+
+	var result LokiDetectedFieldsResult
+	if err := executeLokiRequest(ctx, fieldsURL, conn, &result); err != nil {
+		return nil, fmt.Errorf("detected fields query failed: %v", err)
+	}
+
+	return conn.toolResultText(formatDetectedFields(result.Fields)), nil
+}
+
+// HandleLokiDetectedLabels handles Loki detected labels tool requests
+func HandleLokiDetectedLabels(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	conn, err := lokiConnectionFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, err := conn.timeRangeFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("start", strconv.FormatInt(start, 10))
+	params.Set("end", strconv.FormatInt(end, 10))
+	if query, ok := request.Params.Arguments["query"].(string); ok && query != "" {
+		params.Set("query", query)
+	}
+
+	labelsURL, err := buildLokiURL(conn.URL, "detected_labels", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query URL: %v", err)
+	}
+
+	var result LokiDetectedLabelsResult
+	if err := executeLokiRequest(ctx, labelsURL, conn, &result); err != nil {
+		return nil, fmt.Errorf("detected labels query failed: %v", err)
+	}
+
+	return conn.toolResultText(formatDetectedLabels(result.DetectedLabels)), nil
+}
+
+// formatDetectedFields formats detected fields sorted by name
+func formatDetectedFields(fields []LokiDetectedField) string {
+	if len(fields) == 0 {
+		return "No fields detected for the query"
+	}
+
+	sorted := append([]LokiDetectedField(nil), fields...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Label < sorted[j].Label
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d detected fields:\n", len(sorted))
+	for _, field := range sorted {
+		fmt.Fprintf(&b, "- %s (type: %s, cardinality: %d", field.Label, field.Type, field.Cardinality)
+		if len(field.Parsers) > 0 {
+			fmt.Fprintf(&b, ", parsers: %s", strings.Join(field.Parsers, ", "))
+		} else {
+			b.WriteString(", structured metadata")
+		}
+		b.WriteString(")\n")
+	}
+	return b.String()
+}
+
+// formatDetectedLabels formats detected labels sorted by name
+func formatDetectedLabels(labels []LokiDetectedLabel) string {
+	if len(labels) == 0 {
+		return "No labels detected for the query"
+	}
+
+	sorted := append([]LokiDetectedLabel(nil), labels...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Label < sorted[j].Label
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d detected labels:\n", len(sorted))
+	for _, label := range sorted {
+		fmt.Fprintf(&b, "- %s (cardinality: %d)\n", label.Label, label.Cardinality)
+	}
+	return b.String()
+}
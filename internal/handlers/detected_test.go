@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestHandleLokiDetectedFields tests that detected fields are listed with type, cardinality and parsers
+func TestHandleLokiDetectedFields(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/detected_fields" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("query") != `{app="api"}` || q.Get("line_limit") != "500" {
+			t.Errorf("Unexpected parameters: %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"fields":[
+			{"label":"status","type":"int","cardinality":4,"parsers":["json"]},
+			{"label":"duration","type":"duration","cardinality":120,"parsers":["logfmt","json"]},
+			{"label":"trace_id","type":"string","cardinality":900,"parsers":null}
+		],"limit":1000}`))
+	}))
+	defer server.Close()
+
+	result, err := HandleLokiDetectedFields(context.Background(), newCallToolRequest(map[string]any{
+		"url":        server.URL,
+		"query":      `{app="api"}`,
+		"line_limit": float64(500),
+		"start":      "2024-01-15T10:00:00Z",
+		"end":        "2024-01-15T11:00:00Z",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiDetectedFields failed: %v", err)
+	}
+
+	expected := "Found 3 detected fields:\n" +
+		"- duration (type: duration, cardinality: 120, parsers: logfmt, json)\n" +
+		"- status (type: int, cardinality: 4, parsers: json)\n" +
+		"- trace_id (type: string, cardinality: 900, structured metadata)\n\n" +
+		"Time range: 2024-01-15T10:00:00Z to 2024-01-15T11:00:00Z (1h)"
+	if output := resultText(t, result); output != expected {
+		t.Errorf("Expected %q, got %q", expected, output)
+	}
+}
+
+// TestHandleLokiDetectedLabels tests that detected labels are listed with their cardinality
+func TestHandleLokiDetectedLabels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/detected_labels" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"detectedLabels":[{"label":"pod","cardinality":12},{"label":"namespace","cardinality":3}]}`))
+	}))
+	defer server.Close()
+
+	result, err := HandleLokiDetectedLabels(context.Background(), newCallToolRequest(map[string]any{
+		"url":   server.URL,
+		"query": `{app="api"}`,
+		"start": "2024-01-15T10:00:00Z",
+		"end":   "2024-01-15T11:00:00Z",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiDetectedLabels failed: %v", err)
+	}
+
+	expected := "Found 2 detected labels:\n- namespace (cardinality: 3)\n- pod (cardinality: 12)\n\nTime range: 2024-01-15T10:00:00Z to 2024-01-15T11:00:00Z (1h)"
+	if output := resultText(t, result); output != expected {
+		t.Errorf("Expected %q, got %q", expected, output)
+	}
+}
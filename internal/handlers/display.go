@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
+)
+
+// formatOptions controls how query results are rendered
+type formatOptions struct {
+	// Format is one of the output formats, with "" meaning text
+	Format  string
+	Display config.DisplayConfig
+	// MaxOutputBytes bounds the size of text results and MaxLineBytes the
+	// size of each log line in them, with zero meaning unlimited
+	MaxOutputBytes int
+	MaxLineBytes   int
+	// Dedup is one of the dedup modes, with "" meaning off
+	Dedup string
+	// Location is the timezone times are printed in, with nil meaning UTC
+	Location *time.Location
+}
+
+// displayOptions returns the schema options selecting the labels shown in
+// formatted results
+func displayOptions() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithArray("include_labels",
+			mcp.Description("Only show these labels in stream headers; glob patterns such as k8s_* are allowed (default: all labels)"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithArray("exclude_labels",
+			mcp.Description("Hide these labels in stream headers, e.g. [\"pod\", \"container_id\"]; glob patterns are allowed"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+		mcp.WithBoolean("hide_common_labels",
+			mcp.Description("Print labels shared by all streams once instead of in every stream header (default: false)"),
+		),
+	}
+}
+
+// formatOptionsFromRequest returns the output format, the output budget, the
+// dedup mode and the display settings of the connection, overridden by the
+// include_labels, exclude_labels and hide_common_labels arguments
+func (c lokiConnection) formatOptionsFromRequest(args map[string]any) (formatOptions, error) {
+	format, err := outputFormatFromRequest(args)
+	if err != nil {
+		return formatOptions{}, err
+	}
+	display := c.Display
+
+	if value, ok := args["include_labels"]; ok {
+		labels, err := labelListArgument("include_labels", value)
+		if err != nil {
+			return formatOptions{}, err
+		}
+		display.IncludeLabels = labels
+	}
+	if value, ok := args["exclude_labels"]; ok {
+		labels, err := labelListArgument("exclude_labels", value)
+		if err != nil {
+			return formatOptions{}, err
+		}
+		display.ExcludeLabels = labels
+	}
+	if hide, ok := args["hide_common_labels"].(bool); ok {
+		display.HideCommonLabels = hide
+	}
+
+	if err := display.Validate(); err != nil {
+		return formatOptions{}, err
+	}
+	dedup, err := dedupFromRequest(args)
+	if err != nil {
+		return formatOptions{}, err
+	}
+
+	// Print times in the timezone the time range is resolved in
+	loc, err := defaultLocation()
+	if err != nil {
+		return formatOptions{}, err
+	}
+
+	maxOutput, maxLine := outputBudgetFromRequest(args)
+	return formatOptions{Format: format, Display: display, MaxOutputBytes: maxOutput, MaxLineBytes: maxLine, Dedup: dedup, Location: loc}, nil
+}
+
+// location returns the timezone times are printed in
+func (o formatOptions) location() *time.Location {
+	if o.Location == nil {
+		return time.UTC
+	}
+	return o.Location
+}
+
+// labelListArgument accepts a list of label names or a comma-separated string
+func labelListArgument(name string, value any) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return config.SplitLabelList(v), nil
+	case []string:
+		return v, nil
+	case []any:
+		labels := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid %s parameter: expected strings, got %T", name, item)
+			}
+			if s = strings.TrimSpace(s); s != "" {
+				labels = append(labels, s)
+			}
+		}
+		return labels, nil
+	default:
+		return nil, fmt.Errorf("invalid %s parameter: expected a list of label names, got %T", name, value)
+	}
+}
+
+// visibleLabels returns the labels selected for display by the include and
+// exclude lists
+func (o formatOptions) visibleLabels(labels map[string]string) map[string]string {
+	if len(o.Display.IncludeLabels) == 0 && len(o.Display.ExcludeLabels) == 0 {
+		return labels
+	}
+
+	visible := make(map[string]string, len(labels))
+	for name, value := range labels {
+		if len(o.Display.IncludeLabels) > 0 && !config.MatchLabel(o.Display.IncludeLabels, name) {
+			continue
+		}
+		if config.MatchLabel(o.Display.ExcludeLabels, name) {
+			continue
+		}
+		visible[name] = value
+	}
+	return visible
+}
+
+// labelHeaders returns the visible labels of each label set and, if common
+// labels are hidden, the labels shared by all sets, which are then removed
+// from the individual sets
+func (o formatOptions) labelHeaders(sets []map[string]string) ([]map[string]string, map[string]string) {
+	visible := make([]map[string]string, len(sets))
+	for i, labels := range sets {
+		visible[i] = o.visibleLabels(labels)
+	}
+	if !o.Display.HideCommonLabels || len(visible) == 0 {
+		return visible, nil
+	}
+
+	common := make(map[string]string, len(visible[0]))
+	for name, value := range visible[0] {
+		common[name] = value
+	}
+	for _, labels := range visible[1:] {
+		for name, value := range common {
+			if v, ok := labels[name]; !ok || v != value {
+				delete(common, name)
+			}
+		}
+	}
+	if len(common) == 0 {
+		return visible, nil
+	}
+
+	for i, labels := range visible {
+		rest := make(map[string]string, len(labels))
+		for name, value := range labels {
+			if _, ok := common[name]; !ok {
+				rest[name] = value
+			}
+		}
+		visible[i] = rest
+	}
+	return visible, common
+}
+
+// formatLabelPairs formats a label set as "k=v, ..." sorted by label name
+func formatLabelPairs(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, labels[name]))
+	}
+	return strings.Join(pairs, ", ")
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
+)
+
+// displayTestResult is a streams result whose streams share the app and env labels
+var displayTestResult = &LokiResult{
+	Data: LokiData{
+		ResultType: ResultTypeStreams,
+		Result: []LokiEntry{
+			{Stream: map[string]string{"env": "prod", "app": "api", "pod": "api-7d9f", "level": "error"}, Values: [][]string{{"1705312245000000000", "a"}}},
+			{Stream: map[string]string{"level": "info", "pod": "api-5c2b", "app": "api", "env": "prod"}, Values: [][]string{{"1705312244000000000", "b"}}},
+		},
+	},
+}
+
+// TestFormatLokiResults_SortedLabels tests that stream headers list labels in the same order on every run
+func TestFormatLokiResults_SortedLabels(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		output, err := formatLokiResults(displayTestResult)
+		if err != nil {
+			t.Fatalf("formatLokiResults failed: %v", err)
+		}
+		if !strings.Contains(output, "Stream (app=api, env=prod, level=error, pod=api-7d9f) 1:\n") ||
+			!strings.Contains(output, "Stream (app=api, env=prod, level=info, pod=api-5c2b) 2:\n") {
+			t.Fatalf("Expected sorted labels, got:\n%s", output)
+		}
+	}
+}
+
+// TestFormatLokiResults_HideCommonLabels tests that labels shared by all streams are printed once
+func TestFormatLokiResults_HideCommonLabels(t *testing.T) {
+	opts := formatOptions{Display: config.DisplayConfig{HideCommonLabels: true}}
+	output, err := formatLokiResultsWithOptions(displayTestResult, opts)
+	if err != nil {
+		t.Fatalf("formatLokiResultsWithOptions failed: %v", err)
+	}
+
+	expected := "Found 2 streams:\n\n" +
+		"Common labels: app=api, env=prod\n\n" +
+		"Stream (level=error, pod=api-7d9f) 1:\n"
+	if !strings.HasPrefix(output, expected) || !strings.Contains(output, "Stream (level=info, pod=api-5c2b) 2:\n") {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+}
+
+// TestFormatLokiResults_IncludeExcludeLabels tests the label allow and deny lists, including glob patterns
+func TestFormatLokiResults_IncludeExcludeLabels(t *testing.T) {
+	opts := formatOptions{Display: config.DisplayConfig{ExcludeLabels: []string{"pod", "e*"}}}
+	output, err := formatLokiResultsWithOptions(displayTestResult, opts)
+	if err != nil {
+		t.Fatalf("formatLokiResultsWithOptions failed: %v", err)
+	}
+	if !strings.Contains(output, "Stream (app=api, level=error) 1:\n") {
+		t.Errorf("Expected pod and env to be hidden, got:\n%s", output)
+	}
+
+	opts = formatOptions{Display: config.DisplayConfig{IncludeLabels: []string{"level", "pod"}, ExcludeLabels: []string{"pod"}, HideCommonLabels: true}}
+	output, err = formatLokiResultsWithOptions(displayTestResult, opts)
+	if err != nil {
+		t.Fatalf("formatLokiResultsWithOptions failed: %v", err)
+	}
+	if strings.Contains(output, "Common labels") || !strings.Contains(output, "Stream (level=error) 1:\n") || !strings.Contains(output, "Stream (level=info) 2:\n") {
+		t.Errorf("Expected only level to be shown, got:\n%s", output)
+	}
+}
+
+// TestHandleLokiQuery_DisplayArguments tests that the display arguments override the configured display settings
+func TestHandleLokiQuery_DisplayArguments(t *testing.T) {
+	t.Setenv(config.EnvLokiExcludeLabels, "level")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[
+			{"stream":{"app":"api","pod":"a","level":"error"},"values":[["1705312245000000000","x"]]},
+			{"stream":{"app":"api","pod":"b","level":"error"},"values":[["1705312244000000000","y"]]}
+		]}}`))
+	}))
+	defer server.Close()
+
+	request := map[string]any{"query": `{app="api"}`, "url": server.URL}
+	result, err := HandleLokiQuery(context.Background(), newCallToolRequest(request))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if text := resultText(t, result); !strings.Contains(text, "Stream (app=api, pod=a) 1:") {
+		t.Errorf("Expected level to be hidden by the environment, got:\n%s", text)
+	}
+
+	request["exclude_labels"] = []any{"pod"}
+	request["hide_common_labels"] = true
+	result, err = HandleLokiQuery(context.Background(), newCallToolRequest(request))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	text := resultText(t, result)
+	if !strings.Contains(text, "Common labels: app=api, level=error\n") || !strings.Contains(text, "Stream 1:\n") {
+		t.Errorf("Expected the arguments to override the environment, got:\n%s", text)
+	}
+
+	request["include_labels"] = []any{"["}
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(request)); err == nil || !strings.Contains(err.Error(), "invalid label pattern") {
+		t.Errorf("Expected label pattern error, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Environment variable name for the UID of the Grafana Loki datasource to
+// query through the Grafana datasource proxy. LOKI_URL is then the URL of
+// the Grafana instance.
+const EnvLokiGrafanaDatasourceUID = "LOKI_GRAFANA_DATASOURCE_UID"
+
+// GrafanaDatasource represents a datasource returned by the Grafana datasources API
+type GrafanaDatasource struct {
+	ID        int64  `json:"id"`
+	UID       string `json:"uid"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	URL       string `json:"url"`
+	IsDefault bool   `json:"isDefault"`
+}
+
+// grafanaProxyEnabled reports whether any connection goes through the Grafana
+// datasource proxy, in which case the tools accept a datasource UID
+func grafanaProxyEnabled() bool {
+	if os.Getenv(EnvLokiGrafanaDatasourceUID) != "" {
+		return true
+	}
+	if cfg := currentConfig(); cfg != nil {
+		for _, ds := range cfg.Datasources {
+			if ds.GrafanaDatasourceUID != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// grafanaProxyURL returns the base URL of the Loki API behind the Grafana
+// datasource proxy, e.g. https://grafana/api/datasources/proxy/uid/<uid>
+func grafanaProxyURL(grafanaURL, uid string) (string, error) {
+	u, err := url.Parse(grafanaURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid Grafana URL: %v", err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/datasources/proxy/uid/" + url.PathEscape(uid)
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// NewLokiGrafanaDatasourcesTool creates and returns a tool for listing the Loki datasources of a Grafana instance
+func NewLokiGrafanaDatasourcesTool() mcp.Tool {
+	options := []mcp.ToolOption{
+		mcp.WithDescription("List the Loki datasources configured in Grafana. Use the UID of a datasource to query it through the Grafana datasource proxy. The url argument is the Grafana URL, and token a Grafana service account token"),
+	}
+	options = append(options, lokiConnectionOptions()...)
+
+	return mcp.NewTool("loki_grafana_datasources", options...)
+}
+
+// HandleLokiGrafanaDatasources handles Grafana datasource listing tool requests
+func HandleLokiGrafanaDatasources(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	conn, err := lokiConnectionFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Outside of proxy mode the connection URL is the Grafana URL itself
+	grafanaURL := conn.GrafanaURL
+	if grafanaURL == "" {
+		grafanaURL = conn.URL
+	}
+
+	u, err := url.Parse(grafanaURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Grafana URL: %v", err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/datasources"
+
+	var datasources []GrafanaDatasource
+	if err := executeLokiRequest(ctx, u.String(), conn, &datasources); err != nil {
+		return nil, fmt.Errorf("grafana datasources query failed: %v", err)
+	}
+
+	return conn.toolResultText(formatGrafanaDatasources(datasources, conn.GrafanaDatasourceUID)), nil
+}
+
+// formatGrafanaDatasources formats the Loki datasources sorted by name,
+// marking Grafana's default and the one currently selected
+func formatGrafanaDatasources(datasources []GrafanaDatasource, selectedUID string) string {
+	var loki []GrafanaDatasource
+	for _, ds := range datasources {
+		if ds.Type == "loki" {
+			loki = append(loki, ds)
+		}
+	}
+
+	if len(loki) == 0 {
+		return "No Loki datasources found in Grafana"
+	}
+	sort.Slice(loki, func(i, j int) bool {
+		return loki[i].Name < loki[j].Name
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d Loki datasources:\n", len(loki))
+	for _, ds := range loki {
+		fmt.Fprintf(&b, "- %s (uid: %s)", ds.Name, ds.UID)
+		if ds.URL != "" {
+			fmt.Fprintf(&b, " %s", ds.URL)
+		}
+		if ds.IsDefault {
+			b.WriteString(" [default]")
+		}
+		if ds.UID == selectedUID {
+			b.WriteString(" [selected]")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
+)
+
+// TestLokiQuery_GrafanaProxy tests that queries are sent through the Grafana datasource proxy
+func TestLokiQuery_GrafanaProxy(t *testing.T) {
+	var last *http.Request
+	grafana := recordingLokiServer(t, &last)
+
+	useConfig(t, &config.Config{
+		Datasources: []config.Datasource{{
+			Name:                 "grafana",
+			URL:                  grafana.URL + "/grafana/",
+			Token:                "glsa_service_account",
+			GrafanaDatasourceUID: "loki-prod",
+		}},
+	})
+
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`})); err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if last.URL.Path != "/grafana/api/datasources/proxy/uid/loki-prod/loki/api/v1/query_range" {
+		t.Errorf("Unexpected proxy path: %s", last.URL.Path)
+	}
+	if last.Header.Get("Authorization") != "Bearer glsa_service_account" {
+		t.Errorf("Expected the service account token, got %q", last.Header.Get("Authorization"))
+	}
+
+	// Another Grafana datasource can be selected by UID
+	if _, err := HandleLokiInstantQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`, "grafana_datasource_uid": "loki-staging"})); err != nil {
+		t.Fatalf("HandleLokiInstantQuery failed: %v", err)
+	}
+	if last.URL.Path != "/grafana/api/datasources/proxy/uid/loki-staging/loki/api/v1/query" {
+		t.Errorf("Unexpected proxy path: %s", last.URL.Path)
+	}
+
+	if _, ok := NewLokiQueryTool().InputSchema.Properties["grafana_datasource_uid"]; !ok {
+		t.Errorf("Expected a grafana_datasource_uid argument in proxy mode")
+	}
+}
+
+// TestLokiQuery_GrafanaProxyFromEnv tests enabling the Grafana datasource proxy from the environment
+func TestLokiQuery_GrafanaProxyFromEnv(t *testing.T) {
+	if _, ok := NewLokiQueryTool().InputSchema.Properties["grafana_datasource_uid"]; ok {
+		t.Errorf("Expected no grafana_datasource_uid argument without proxy mode")
+	}
+
+	var last *http.Request
+	grafana := recordingLokiServer(t, &last)
+	t.Setenv(EnvLokiURL, grafana.URL)
+	t.Setenv(EnvLokiGrafanaDatasourceUID, "P8E80F9AEF21F6940")
+
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`})); err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if last.URL.Path != "/api/datasources/proxy/uid/P8E80F9AEF21F6940/loki/api/v1/query_range" {
+		t.Errorf("Unexpected proxy path: %s", last.URL.Path)
+	}
+}
+
+// TestHandleLokiGrafanaDatasources tests listing the Loki datasources of a Grafana instance
+func TestHandleLokiGrafanaDatasources(t *testing.T) {
+	var path, auth string
+	grafana := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`[
+			{"id":1,"uid":"prom","name":"Prometheus","type":"prometheus","url":"http://prometheus:9090"},
+			{"id":2,"uid":"loki-staging","name":"Loki Staging","type":"loki","url":"http://loki-staging:3100"},
+			{"id":3,"uid":"loki-prod","name":"Loki","type":"loki","url":"http://loki:3100","isDefault":true}
+		]`))
+	}))
+	defer grafana.Close()
+
+	t.Setenv(EnvLokiURL, grafana.URL)
+	t.Setenv(EnvLokiGrafanaDatasourceUID, "loki-staging")
+	t.Setenv("LOKI_TOKEN", "glsa_service_account")
+
+	result, err := HandleLokiGrafanaDatasources(context.Background(), newCallToolRequest(map[string]any{}))
+	if err != nil {
+		t.Fatalf("HandleLokiGrafanaDatasources failed: %v", err)
+	}
+
+	// The datasources API is called on Grafana itself, not through the proxy
+	if path != "/api/datasources" || auth != "Bearer glsa_service_account" {
+		t.Errorf("Unexpected request: path %s, authorization %q", path, auth)
+	}
+
+	expected := "Found 2 Loki datasources:\n" +
+		"- Loki (uid: loki-prod) http://loki:3100 [default]\n" +
+		"- Loki Staging (uid: loki-staging) http://loki-staging:3100 [selected]\n"
+	if text := resultText(t, result); text != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, text)
+	}
+}
+
+// TestFormatGrafanaDatasources_Empty tests the output when Grafana has no Loki datasources
+func TestFormatGrafanaDatasources_Empty(t *testing.T) {
+	output := formatGrafanaDatasources([]GrafanaDatasource{{UID: "prom", Name: "Prometheus", Type: "prometheus"}}, "")
+	if !strings.Contains(output, "No Loki datasources found") {
+		t.Errorf("Unexpected output: %s", output)
+	}
+}
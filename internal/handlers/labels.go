@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// LokiLabelsResult represents the response of the Loki label endpoints
+type LokiLabelsResult struct {
+	Status string   `json:"status"`
+	Data   []string `json:"data"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// NewLokiLabelNamesTool creates and returns a tool for listing Loki label names
+func NewLokiLabelNamesTool() mcp.Tool {
+	options := []mcp.ToolOption{
+		mcp.WithDescription("List the label names known to Grafana Loki. Use this to discover which labels exist before writing a LogQL stream selector"),
+	}
+	options = append(options, lokiConnectionOptions()...)
+	options = append(options,
+		mcp.WithString("query",
+			mcp.Description("Optional stream selector to restrict the labels returned, e.g. {app=\"api\"}"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for the lookup (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the lookup (default: now)"),
+		),
+	)
+
+	return mcp.NewTool("loki_label_names", options...)
+}
+
+// NewLokiLabelValuesTool creates and returns a tool for listing the values of a Loki label
+func NewLokiLabelValuesTool() mcp.Tool {
+	options := []mcp.ToolOption{
+		mcp.WithDescription("List the values of a label in Grafana Loki. Use this to discover valid values before writing a LogQL stream selector"),
+		mcp.WithString("label",
+			mcp.Required(),
+			mcp.Description("Label name to list values for, e.g. job"),
+		),
+	}
+	options = append(options, lokiConnectionOptions()...)
+	options = append(options,
+		mcp.WithString("query",
+			mcp.Description("Optional stream selector to restrict the values returned, e.g. {app=\"api\"}"),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time for the lookup (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the lookup (default: now)"),
+		),
+	)
+
+	return mcp.NewTool("loki_label_values", options...)
+}
+
+// HandleLokiLabelNames handles Loki label names tool requests
+func HandleLokiLabelNames(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	conn, err := lokiConnectionFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	labelsURL, err := buildLokiLabelsURL(conn, "labels", request)
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := executeLokiLabelsQuery(ctx, labelsURL, conn)
+	if err != nil {
+		return nil, fmt.Errorf("label names query failed: %v", err)
+	}
+
+	return conn.toolResultText(formatLabelList("label names", labels)), nil
+}
+
+// HandleLokiLabelValues handles Loki label values tool requests
+func HandleLokiLabelValues(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	label, ok := request.Params.Arguments["label"].(string)
+	if !ok || label == "" {
+		return nil, fmt.Errorf("label parameter is required")
+	}
+	conn, err := lokiConnectionFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("label/%s/values", url.PathEscape(label))
+	valuesURL, err := buildLokiLabelsURL(conn, endpoint, request)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := executeLokiLabelsQuery(ctx, valuesURL, conn)
+	if err != nil {
+		return nil, fmt.Errorf("label values query failed: %v", err)
+	}
+
+	return conn.toolResultText(formatLabelList(fmt.Sprintf("values for label %q", label), values)), nil
+}
+
+// buildLokiLabelsURL constructs the URL of a label endpoint from the time
+// range and optional selector in the request
+func buildLokiLabelsURL(conn lokiConnection, endpoint string, request mcp.CallToolRequest) (string, error) {
+	start, end, err := conn.timeRangeFromRequest(request)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("start", fmt.Sprintf("%d", start))
+	params.Set("end", fmt.Sprintf("%d", end))
+	if query, ok := request.Params.Arguments["query"].(string); ok && query != "" {
+		params.Set("query", query)
+	}
+
+	labelsURL, err := buildLokiURL(conn.URL, endpoint, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to build query URL: %v", err)
+	}
+	return labelsURL, nil
+}
+
+// executeLokiLabelsQuery sends a label request to Loki and returns the labels
+func executeLokiLabelsQuery(ctx context.Context, labelsURL string, conn lokiConnection) ([]string, error) {
+	var result LokiLabelsResult
+	if err := executeLokiRequest(ctx, labelsURL, conn, &result); err != nil {
+		return nil, err
+	}
+
+	// Check for Loki errors
+	if result.Status == "error" {
+		return nil, fmt.Errorf("loki error: %s", result.Error)
+	}
+
+	return result.Data, nil
+}
+
+// formatLabelList formats a list of label names or values, sorted alphabetically
+func formatLabelList(what string, labels []string) string {
+	if len(labels) == 0 {
+		return fmt.Sprintf("No %s found", what)
+	}
+
+	sorted := append([]string(nil), labels...)
+	sort.Strings(sorted)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d %s:\n", len(sorted), what)
+	for _, label := range sorted {
+		fmt.Fprintf(&b, "- %s\n", label)
+	}
+	return b.String()
+}
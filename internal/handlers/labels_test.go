@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestHandleLokiLabelNames tests listing label names with a selector and time range
+func TestHandleLokiLabelNames(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/labels" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("query") != `{app="api"}` {
+			t.Errorf("Unexpected query: %s", q.Get("query"))
+		}
+		if q.Get("start") == "" || q.Get("end") == "" {
+			t.Errorf("Expected start and end to be set, got %s", r.URL.RawQuery)
+		}
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			t.Errorf("Unexpected Authorization header: %s", r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"status":"success","data":["job","app","level"]}`))
+	}))
+	defer server.Close()
+
+	result, err := HandleLokiLabelNames(context.Background(), newCallToolRequest(map[string]any{
+		"url":   server.URL,
+		"token": "abc",
+		"query": `{app="api"}`,
+		"start": "2024-01-15T10:00:00Z",
+		"end":   "2024-01-15T11:00:00Z",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiLabelNames failed: %v", err)
+	}
+
+	expected := "Found 3 label names:\n- app\n- job\n- level\n\nTime range: 2024-01-15T10:00:00Z to 2024-01-15T11:00:00Z (1h)"
+	if output := resultText(t, result); output != expected {
+		t.Errorf("Expected %q, got %q", expected, output)
+	}
+}
+
+// TestHandleLokiLabelValues tests listing the values of a single label
+func TestHandleLokiLabelValues(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/label/job/values" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"status":"success","data":["varlogs","api"]}`))
+	}))
+	defer server.Close()
+
+	result, err := HandleLokiLabelValues(context.Background(), newCallToolRequest(map[string]any{
+		"url":   server.URL,
+		"label": "job",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiLabelValues failed: %v", err)
+	}
+
+	output := resultText(t, result)
+	if !strings.HasPrefix(output, `Found 2 values for label "job":`) || !strings.Contains(output, "- api\n- varlogs\n") {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+}
+
+// TestHandleLokiLabelValues_MissingLabel tests that the label argument is required
+func TestHandleLokiLabelValues_MissingLabel(t *testing.T) {
+	_, err := HandleLokiLabelValues(context.Background(), newCallToolRequest(map[string]any{}))
+	if err == nil || !strings.Contains(err.Error(), "label parameter is required") {
+		t.Errorf("Expected missing label error, got %v", err)
+	}
+}
+
+// TestHandleLokiLabelNames_Empty tests the message for an empty label list
+func TestHandleLokiLabelNames_Empty(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":[]}`))
+	}))
+	defer server.Close()
+
+	result, err := HandleLokiLabelNames(context.Background(), newCallToolRequest(map[string]any{
+		"url":   server.URL,
+		"start": "2024-01-15T10:00:00Z",
+		"end":   "2024-01-15T11:00:00Z",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiLabelNames failed: %v", err)
+	}
+	if output := resultText(t, result); output != "No label names found\n\nTime range: 2024-01-15T10:00:00Z to 2024-01-15T11:00:00Z (1h)" {
+		t.Errorf("Unexpected output: %q", output)
+	}
+}
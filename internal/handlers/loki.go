@@ -2,17 +2,22 @@ package handlers
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
 )
 
 // LokiResult represents the structure of Loki query results
@@ -22,10 +27,14 @@ type LokiResult struct {
 	Error  string   `json:"error,omitempty"`
 }
 
-// LokiData represents the data portion of Loki results
+// LokiData represents the data portion of Loki results. Which field is
+// populated depends on ResultType: Result for "streams", Metrics for "matrix"
+// and "vector", and Scalar for "scalar".
 type LokiData struct {
-	ResultType string      `json:"resultType"`
-	Result     []LokiEntry `json:"result"`
+	ResultType string       `json:"resultType"`
+	Result     []LokiEntry  `json:"result"`
+	Metrics    []LokiMetric `json:"-"`
+	Scalar     *LokiSample  `json:"-"`
 }
 
 // LokiEntry represents a single log entry from Loki
@@ -34,6 +43,100 @@ type LokiEntry struct {
 	Values [][]string        `json:"values"` // [timestamp, log line]
 }
 
+// LokiMetric represents a single time series returned by a metric query.
+// Vector results carry a single Value, matrix results carry Values.
+type LokiMetric struct {
+	Metric map[string]string `json:"metric"`
+	Value  *LokiSample       `json:"value,omitempty"`
+	Values []LokiSample      `json:"values,omitempty"`
+}
+
+// LokiSample represents a single [timestamp, value] pair of a metric result
+type LokiSample struct {
+	Timestamp float64 // Unix timestamp in seconds, with fractional part
+	Value     string
+}
+
+// Result types returned by the Loki query API
+const (
+	ResultTypeStreams = "streams"
+	ResultTypeMatrix  = "matrix"
+	ResultTypeVector  = "vector"
+	ResultTypeScalar  = "scalar"
+)
+
+// UnmarshalJSON decodes the result according to its resultType
+func (d *LokiData) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*d = LokiData{ResultType: raw.ResultType}
+	if len(raw.Result) == 0 || string(raw.Result) == "null" {
+		return nil
+	}
+
+	switch raw.ResultType {
+	case ResultTypeStreams, "":
+		return json.Unmarshal(raw.Result, &d.Result)
+	case ResultTypeMatrix, ResultTypeVector:
+		return json.Unmarshal(raw.Result, &d.Metrics)
+	case ResultTypeScalar:
+		var sample LokiSample
+		if err := json.Unmarshal(raw.Result, &sample); err != nil {
+			return err
+		}
+		d.Scalar = &sample
+		return nil
+	default:
+		return fmt.Errorf("unsupported result type: %s", raw.ResultType)
+	}
+}
+
+// UnmarshalJSON decodes a [timestamp, "value"] pair
+func (s *LokiSample) UnmarshalJSON(data []byte) error {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	if len(pair) != 2 {
+		return fmt.Errorf("invalid sample: expected 2 elements, got %d", len(pair))
+	}
+
+	// Loki sends the timestamp as a number; be lenient and accept a string too
+	var ts json.Number
+	if err := json.Unmarshal(pair[0], &ts); err != nil {
+		var tsStr string
+		if err := json.Unmarshal(pair[0], &tsStr); err != nil {
+			return fmt.Errorf("invalid sample timestamp: %s", string(pair[0]))
+		}
+		ts = json.Number(tsStr)
+	}
+	timestamp, err := ts.Float64()
+	if err != nil {
+		return fmt.Errorf("invalid sample timestamp: %v", err)
+	}
+
+	var value string
+	if err := json.Unmarshal(pair[1], &value); err != nil {
+		return fmt.Errorf("invalid sample value: %s", string(pair[1]))
+	}
+
+	s.Timestamp = timestamp
+	s.Value = value
+	return nil
+}
+
+// Time returns the sample timestamp as a time.Time
+func (s LokiSample) Time() time.Time {
+	sec, frac := math.Modf(s.Timestamp)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e9)))
+}
+
 // SSEEvent represents an event to be sent via SSE
 type SSEEvent struct {
 	Type      string `json:"type"`
@@ -48,24 +151,174 @@ const EnvLokiURL = "LOKI_URL"
 // Default Loki URL when environment variable is not set
 const DefaultLokiURL = "http://localhost:3100"
 
-// NewLokiQueryTool creates and returns a tool for querying Grafana Loki
-func NewLokiQueryTool() mcp.Tool {
-	// Get Loki URL from environment variable or use default
+// Environment variable name for the default Loki tenant (X-Scope-OrgID)
+const EnvLokiOrgID = "LOKI_ORG_ID"
+
+// maxTenantIDLength is the longest tenant ID Loki accepts
+const maxTenantIDLength = 150
+
+// Default values for optional query parameters
+const (
+	DefaultQueryLimit = 100
+	DirectionBackward = "backward"
+	DirectionForward  = "forward"
+)
+
+// lokiConnection holds the settings needed to reach a Loki server
+type lokiConnection struct {
+	URL      string
+	OrgID    string
+	Username string
+	Password string
+	Token    string
+	TLS      config.TLSConfig
+	OAuth2   *config.OAuth2Config
+	HTTP     config.HTTPConfig
+	Retry    config.RetryConfig
+	// Timeout bounds the whole tool call, including retries and pages;
+	// zero means the default timeout
+	Timeout time.Duration
+	// Headers are static headers configured server-side
+	Headers map[string]string
+	// Display selects the stream labels shown in formatted results
+	Display config.DisplayConfig
+	// GrafanaURL and GrafanaDatasourceUID are set when Loki is reached
+	// through the Grafana datasource proxy; URL is then the proxy URL
+	GrafanaURL           string
+	GrafanaDatasourceUID string
+	// Limits from the datasource profile; zero means unset
+	DefaultLimit int
+	MaxLimit     int
+	// retries records the retries made during the tool call
+	retries *retryStats
+	// times records the absolute times the time arguments resolved to
+	times *resolvedTimes
+	// deadline is when the tool call times out, Timeout after it started
+	deadline time.Time
+}
+
+// defaultLokiURL returns the Loki URL from the environment or the default
+func defaultLokiURL() string {
 	lokiURL := os.Getenv(EnvLokiURL)
 	if lokiURL == "" {
 		lokiURL = DefaultLokiURL
 	}
+	return lokiURL
+}
 
-	return mcp.NewTool("loki_query",
-		mcp.WithDescription("Run a query against Grafana Loki"),
-		mcp.WithString("query",
-			mcp.Required(),
-			mcp.Description("LogQL query string"),
-		),
-		mcp.WithString("url",
-			mcp.Description(fmt.Sprintf("Loki server URL (default: %s from %s env var)", lokiURL, EnvLokiURL)),
-			mcp.DefaultString(lokiURL),
+// applyEnvSecrets sets the credentials, OAuth2 settings, custom headers and
+// TLS settings configured in the environment for LOKI_URL
+func (c *lokiConnection) applyEnvSecrets() error {
+	credentials, err := config.CredentialsFromEnv()
+	if err != nil {
+		return err
+	}
+	c.Username = credentials.Username
+	c.Password = credentials.Password
+	c.Token = credentials.Token
+
+	if c.OAuth2, err = config.OAuth2ConfigFromEnv(); err != nil {
+		return err
+	}
+	if c.Headers, err = config.HeadersFromEnv(); err != nil {
+		return err
+	}
+
+	// TLS settings are only configured server-side, so a client certificate
+	// is never presented to a URL chosen by the caller
+	c.TLS, err = config.TLSConfigFromEnv()
+	return err
+}
+
+// datasourceForURL returns the configured datasource with the same scheme
+// and host as rawURL, or nil if there is none
+func datasourceForURL(cfg *config.Config, rawURL string) *config.Datasource {
+	for i := range cfg.Datasources {
+		if sameOrigin(rawURL, cfg.Datasources[i].URL) {
+			return &cfg.Datasources[i]
+		}
+	}
+	return nil
+}
+
+// sameOrigin reports whether two URLs have the same scheme and host, with
+// the default port of the scheme made explicit
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil || ua.Host == "" {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil || ub.Host == "" {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(originHost(ua), originHost(ub))
+}
+
+// originHost returns the host and port of a URL, adding the default port of
+// http and https URLs
+func originHost(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return net.JoinHostPort(u.Hostname(), "443")
+	case "http":
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+	return u.Host
+}
+
+// lokiConnectionOptions returns the tool options shared by every Loki tool
+// for selecting the server and authenticating against it. The credential
+// options are left out when credentials are resolved server-side.
+func lokiConnectionOptions() []mcp.ToolOption {
+	// Get Loki URL from environment variable or use default
+	lokiURL := defaultLokiURL()
+	urlOption := mcp.WithString("url",
+		mcp.Description(fmt.Sprintf("Loki server URL (default: %s from %s env var)", lokiURL, EnvLokiURL)),
+		mcp.DefaultString(lokiURL),
+	)
+
+	var options []mcp.ToolOption
+	if cfg := currentConfig(); cfg != nil && len(cfg.Datasources) > 0 {
+		description := "Name of a configured Loki datasource to query"
+		if defaultName := cfg.DefaultName(); defaultName != "" {
+			description += fmt.Sprintf(" (default: %s)", defaultName)
+		}
+		options = append(options, mcp.WithString("datasource",
+			mcp.Description(description),
+			mcp.Enum(cfg.Names()...),
+		))
+
+		// Advertising a default URL would make clients bypass the datasources
+		urlOption = mcp.WithString("url",
+			mcp.Description("Loki server URL to query instead of a configured datasource"),
+		)
+	}
+
+	options = append(options,
+		urlOption,
+		mcp.WithString("org_id",
+			mcp.Description(fmt.Sprintf("Tenant ID sent as X-Scope-OrgID for multi-tenant Loki; separate several tenants with | for a federated query (default: %s env var)", EnvLokiOrgID)),
 		),
+	)
+
+	options = append(options, mcp.WithString("timeout",
+		mcp.Description(fmt.Sprintf("Timeout for the whole tool call, including retries and pages, as a duration, e.g. 2m; capped at the server maximum (default: %s, max: %s unless configured otherwise)", defaultRequestTimeout, defaultMaxRequestTimeout)),
+	))
+
+	if grafanaProxyEnabled() {
+		options = append(options, mcp.WithString("grafana_datasource_uid",
+			mcp.Description("UID of the Grafana Loki datasource to query through the Grafana datasource proxy, as listed by loki_grafana_datasources (default: the configured datasource)"),
+		))
+	}
+
+	if serverSide, err := serverSideCredentials(); err == nil && serverSide {
+		return options
+	}
+	return append(options,
 		mcp.WithString("username",
 			mcp.Description("Username for basic authentication"),
 		),
@@ -75,95 +328,536 @@ func NewLokiQueryTool() mcp.Tool {
 		mcp.WithString("token",
 			mcp.Description("Bearer token for authentication"),
 		),
+	)
+}
+
+// lokiConnectionFromRequest resolves the connection for a tool call. A
+// configured datasource is used when one is selected with the datasource
+// argument, when the url argument has the same scheme and host as one, or by
+// default when no url argument is given. Otherwise the URL and tenant come
+// from the tool arguments, falling back to the environment.
+//
+// Server-side secrets (credentials, OAuth2 and custom headers from the
+// environment or a datasource, and TLS client certificates) are only sent to
+// LOKI_URL or the datasource they belong to, never to another url argument.
+// With server-side credentials, such a url argument is rejected. Otherwise
+// credential arguments override the configured credentials.
+func lokiConnectionFromRequest(request mcp.CallToolRequest) (lokiConnection, error) {
+	args := request.Params.Arguments
+	urlArg, _ := args["url"].(string)
+	datasourceArg, _ := args["datasource"].(string)
+
+	serverSide, err := serverSideCredentials()
+	if err != nil {
+		return lokiConnection{}, err
+	}
+	if serverSide {
+		if err := rejectCredentialArguments(args); err != nil {
+			return lokiConnection{}, err
+		}
+	}
+
+	var ds *config.Datasource
+	cfg := currentConfig()
+	if cfg != nil && len(cfg.Datasources) > 0 {
+		switch {
+		case datasourceArg != "" && urlArg != "":
+			return lokiConnection{}, fmt.Errorf("url and datasource cannot be combined")
+		case urlArg != "":
+			ds = datasourceForURL(cfg, urlArg)
+		default:
+			if ds, err = cfg.Datasource(datasourceArg); err != nil {
+				return lokiConnection{}, err
+			}
+		}
+	} else if datasourceArg != "" {
+		return lokiConnection{}, fmt.Errorf("unknown datasource %q: no datasources are configured", datasourceArg)
+	}
+
+	var conn lokiConnection
+	if ds != nil {
+		conn, err = lokiConnectionFromDatasource(ds)
+		if err != nil {
+			return lokiConnection{}, err
+		}
+		if urlArg != "" {
+			conn.URL = urlArg
+		}
+	} else {
+		// Get Loki URL from request arguments, if not present check environment
+		conn.URL = defaultLokiURL()
+		if urlArg != "" {
+			conn.URL = urlArg
+		}
+		conn.OrgID = os.Getenv(EnvLokiOrgID)
+		conn.GrafanaDatasourceUID = os.Getenv(EnvLokiGrafanaDatasourceUID)
+
+		if urlArg == "" || sameOrigin(urlArg, defaultLokiURL()) {
+			if err := conn.applyEnvSecrets(); err != nil {
+				return lokiConnection{}, err
+			}
+		} else if serverSide {
+			return lokiConnection{}, fmt.Errorf("url %q is not allowed with server-side credentials: it must have the same scheme and host as %s or a configured datasource", urlArg, EnvLokiURL)
+		}
+	}
+
+	// Query through the Grafana datasource proxy if a datasource UID is set
+	if uidArg, ok := args["grafana_datasource_uid"].(string); ok && uidArg != "" {
+		conn.GrafanaDatasourceUID = uidArg
+	}
+	if conn.GrafanaDatasourceUID != "" {
+		proxyURL, err := grafanaProxyURL(conn.URL, conn.GrafanaDatasourceUID)
+		if err != nil {
+			return lokiConnection{}, err
+		}
+		conn.GrafanaURL = conn.URL
+		conn.URL = proxyURL
+	}
+
+	// Get tenant from request arguments, overriding the default
+	if orgIDArg, ok := args["org_id"].(string); ok && orgIDArg != "" {
+		conn.OrgID = orgIDArg
+	}
+	if conn.OrgID != "" {
+		normalized, err := normalizeOrgID(conn.OrgID)
+		if err != nil {
+			return lokiConnection{}, err
+		}
+		conn.OrgID = normalized
+	}
+
+	if conn.HTTP.IsZero() {
+		httpSettings, err := config.HTTPConfigFromEnv()
+		if err != nil {
+			return lokiConnection{}, err
+		}
+		conn.HTTP = httpSettings
+	}
+
+	if conn.Retry.IsZero() {
+		retrySettings, err := config.RetryConfigFromEnv()
+		if err != nil {
+			return lokiConnection{}, err
+		}
+		conn.Retry = retrySettings
+	}
+	if conn.Display.IsZero() {
+		displaySettings, err := config.DisplayConfigFromEnv()
+		if err != nil {
+			return lokiConnection{}, err
+		}
+		conn.Display = displaySettings
+	}
+	conn.retries = newRetryStats()
+	conn.times = &resolvedTimes{}
+
+	// Get the request timeout, bounded by the server maximum
+	timeout, err := requestTimeout(conn.HTTP, args)
+	if err != nil {
+		return lokiConnection{}, err
+	}
+	conn.Timeout = timeout
+	conn.deadline = time.Now().Add(timeout)
+
+	// Extract authentication parameters
+	if usernameArg, ok := args["username"].(string); ok && usernameArg != "" {
+		conn.Username = usernameArg
+	}
+	if passwordArg, ok := args["password"].(string); ok && passwordArg != "" {
+		conn.Password = passwordArg
+	}
+	if tokenArg, ok := args["token"].(string); ok && tokenArg != "" {
+		conn.Token = tokenArg
+	}
+
+	return conn, nil
+}
+
+// lokiConnectionFromDatasource returns the connection settings of a configured datasource
+func lokiConnectionFromDatasource(ds *config.Datasource) (lokiConnection, error) {
+	credentials, err := ds.Credentials()
+	if err != nil {
+		return lokiConnection{}, err
+	}
+	headers, err := config.ResolveHeaders(ds.Headers)
+	if err != nil {
+		return lokiConnection{}, fmt.Errorf("datasource %q: %v", ds.Name, err)
+	}
+
+	return lokiConnection{
+		URL:                  ds.URL,
+		OrgID:                ds.OrgID,
+		Username:             credentials.Username,
+		Password:             credentials.Password,
+		Token:                credentials.Token,
+		TLS:                  ds.TLS,
+		OAuth2:               ds.OAuth2,
+		HTTP:                 ds.HTTP,
+		Retry:                ds.Retry,
+		Headers:              headers,
+		Display:              ds.Display,
+		GrafanaDatasourceUID: ds.GrafanaDatasourceUID,
+		DefaultLimit:         ds.DefaultLimit,
+		MaxLimit:             ds.MaxLimit,
+	}, nil
+}
+
+// toolResultText returns a text tool result, noting the time range queried
+// and any retries made while serving the tool call
+func (c lokiConnection) toolResultText(text string) *mcp.CallToolResult {
+	for _, note := range c.notes() {
+		text = strings.TrimRight(text, "\n") + "\n\n" + note
+	}
+	return mcp.NewToolResultText(text)
+}
+
+// notes describes the time range queried and any retries made while
+// serving the tool call
+func (c lokiConnection) notes() []string {
+	var notes []string
+	if summary := c.times.summary(); summary != "" {
+		notes = append(notes, summary)
+	}
+	if summary := c.retries.summary(); summary != "" {
+		notes = append(notes, summary)
+	}
+	return notes
+}
+
+// queryLimit returns the limit argument, or the connection's default limit
+// if it is not set, capped at the connection's maximum limit. A limit below
+// one line is rejected.
+func (c lokiConnection) queryLimit(args map[string]any) (int, error) {
+	limit := DefaultQueryLimit
+	if c.DefaultLimit > 0 {
+		limit = c.DefaultLimit
+	}
+	if limitVal, ok := args["limit"].(float64); ok {
+		if limitVal < 1 {
+			return 0, fmt.Errorf("invalid limit %v: must be at least 1", limitVal)
+		}
+		limit = int(limitVal)
+	}
+	if c.MaxLimit > 0 && limit > c.MaxLimit {
+		limit = c.MaxLimit
+	}
+	return limit, nil
+}
+
+// normalizeOrgID validates a tenant ID, or several tenant IDs separated by
+// "|" for multi-tenant federated queries, and removes surrounding whitespace
+// and duplicate tenants
+func normalizeOrgID(orgID string) (string, error) {
+	var tenants []string
+	seen := make(map[string]bool)
+	for _, tenant := range strings.Split(orgID, "|") {
+		tenant = strings.TrimSpace(tenant)
+		if err := validateTenantID(tenant); err != nil {
+			return "", fmt.Errorf("invalid org_id %q: %v", orgID, err)
+		}
+		if seen[tenant] {
+			continue
+		}
+		seen[tenant] = true
+		tenants = append(tenants, tenant)
+	}
+	return strings.Join(tenants, "|"), nil
+}
+
+// validateTenantID checks a single tenant ID against the rules Loki applies
+func validateTenantID(tenant string) error {
+	switch {
+	case tenant == "":
+		return fmt.Errorf("tenant ID must not be empty")
+	case len(tenant) > maxTenantIDLength:
+		return fmt.Errorf("tenant ID %q is longer than %d characters", tenant, maxTenantIDLength)
+	case tenant == "." || tenant == "..":
+		return fmt.Errorf("tenant ID %q is not allowed", tenant)
+	}
+
+	for _, r := range tenant {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("!-_.*'()", r)) {
+			return fmt.Errorf("tenant ID %q contains unsupported character %q", tenant, r)
+		}
+	}
+	return nil
+}
+
+// applyHeaders adds the static, tenant and authentication headers for the
+// connection to an outgoing request
+func (c lokiConnection) applyHeaders(header http.Header) error {
+	// Static headers first, so the tenant and authentication settings win
+	for name, value := range c.Headers {
+		header.Set(name, value)
+	}
+
+	if c.OrgID != "" {
+		// Tenant for multi-tenant Loki; "a|b" queries several tenants at once
+		header.Set("X-Scope-OrgID", c.OrgID)
+	}
+
+	if c.Token != "" {
+		// Bearer token authentication
+		header.Set("Authorization", "Bearer "+c.Token)
+	} else if c.OAuth2 != nil {
+		// OAuth2 client-credentials authentication, with cached tokens
+		token, err := oauth2Token(c.OAuth2, c.TLS, c.HTTP)
+		if err != nil {
+			return err
+		}
+		header.Set("Authorization", token.Type()+" "+token.AccessToken)
+	} else if c.Username != "" || c.Password != "" {
+		// Basic authentication
+		credentials := base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password))
+		header.Set("Authorization", "Basic "+credentials)
+	}
+
+	return nil
+}
+
+// NewLokiQueryTool creates and returns a tool for querying Grafana Loki
+func NewLokiQueryTool() mcp.Tool {
+	options := []mcp.ToolOption{
+		mcp.WithDescription("Run a query against Grafana Loki"),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("LogQL query string"),
+		),
+	}
+	options = append(options, lokiConnectionOptions()...)
+	options = append(options,
 		mcp.WithString("start",
-			mcp.Description("Start time for the query (default: 1h ago)"),
+			mcp.Description("Start time for the query, e.g. now-1h, 2d ago, yesterday, today 09:00, 2024-01-15 14:00 Europe/Berlin, RFC3339 or a Unix timestamp (default: 1h ago)"),
 		),
 		mcp.WithString("end",
-			mcp.Description("End time for the query (default: now)"),
+			mcp.Description("End time for the query in the same formats as start; now/d means the end of today (default: now)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of entries to return, or the page size when paginating (default: 100)"),
+		),
+		mcp.WithString("direction",
+			mcp.Description("Sort order of log lines: backward returns the newest lines first, forward the oldest, e.g. to read the start of an incident (default: backward)"),
+			mcp.Enum(DirectionBackward, DirectionForward),
+		),
+		mcp.WithString("step",
+			mcp.Description(fmt.Sprintf("Resolution of metric queries as a duration or number of seconds, e.g. 1m (default: computed from the range for about %d points, max %d points)", defaultQueryPoints, MaxQueryPoints)),
+		),
+		mcp.WithString("interval",
+			mcp.Description("For log queries, only return one line per interval, as a duration or number of seconds, e.g. 30s"),
+		),
+		mcp.WithBoolean("paginate",
+			mcp.Description("Fetch more than limit lines by walking the time range page by page, up to max_total_lines and max_total_bytes (default: false)"),
+		),
+		mcp.WithNumber("max_total_lines",
+			mcp.Description(fmt.Sprintf("Total number of lines to fetch when paginating (default: %d, max: %d)", DefaultPaginateMaxLines, MaxPaginateMaxLines)),
+		),
+		mcp.WithNumber("max_total_bytes",
+			mcp.Description(fmt.Sprintf("Total size of the log lines to fetch when paginating (default: %d, max: %d)", DefaultPaginateMaxBytes, MaxPaginateMaxBytes)),
+		),
+		outputFormatOption(),
+	)
+	options = append(options, displayOptions()...)
+	options = append(options, budgetOptions()...)
+	options = append(options, dedupOption())
+
+	return mcp.NewTool("loki_query", options...)
+}
+
+// NewLokiInstantQueryTool creates and returns a tool for evaluating a LogQL
+// query at a single point in time
+func NewLokiInstantQueryTool() mcp.Tool {
+	options := []mcp.ToolOption{
+		mcp.WithDescription("Run an instant query against Grafana Loki, evaluating the query at a single point in time. Best suited for metric queries such as count_over_time or rate"),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("LogQL query string"),
+		),
+	}
+	options = append(options, lokiConnectionOptions()...)
+	options = append(options,
+		mcp.WithString("time",
+			mcp.Description("Evaluation time for the query, e.g. now-5m, yesterday 18:00 or RFC3339 (default: now)"),
+		),
+		mcp.WithString("direction",
+			mcp.Description("Sort order of log lines (default: backward)"),
+			mcp.Enum(DirectionBackward, DirectionForward),
 		),
 		mcp.WithNumber("limit",
 			mcp.Description("Maximum number of entries to return (default: 100)"),
 		),
+		outputFormatOption(),
 	)
+	options = append(options, displayOptions()...)
+	options = append(options, budgetOptions()...)
+	options = append(options, dedupOption())
+
+	return mcp.NewTool("loki_instant_query", options...)
 }
 
 // HandleLokiQuery handles Loki query tool requests
 func HandleLokiQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	// Extract parameters
 	queryString := request.Params.Arguments["query"].(string)
+	conn, err := lokiConnectionFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
 
-	// Get Loki URL from request arguments, if not present check environment
-	var lokiURL string
-	if urlArg, ok := request.Params.Arguments["url"].(string); ok && urlArg != "" {
-		lokiURL = urlArg
-	} else {
-		// Fallback to environment variable
-		lokiURL = os.Getenv(EnvLokiURL)
-		if lokiURL == "" {
-			lokiURL = DefaultLokiURL
-		}
+	start, end, err := conn.timeRangeFromRequest(request)
+	if err != nil {
+		return nil, err
 	}
 
-	// Extract authentication parameters
-	var username, password, token string
-	if usernameArg, ok := request.Params.Arguments["username"].(string); ok {
-		username = usernameArg
+	limit, err := conn.queryLimit(request.Params.Arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	formatting, err := conn.formatOptionsFromRequest(request.Params.Arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := queryRangeOptionsFromRequest(request.Params.Arguments, time.Duration(end-start))
+	if err != nil {
+		return nil, err
+	}
+
+	if paginate, ok := request.Params.Arguments["paginate"].(bool); ok && paginate {
+		budget := paginationBudgetFromRequest(request.Params.Arguments)
+		return runPaginatedLokiQuery(ctx, conn, queryString, start, end, limit, opts, budget, formatting)
+	}
+
+	// Build query URL
+	queryURL, err := buildLokiQueryURL(conn.URL, queryString, start, end, limit, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query URL: %v", err)
 	}
-	if passwordArg, ok := request.Params.Arguments["password"].(string); ok {
-		password = passwordArg
+
+	return runLokiQuery(ctx, conn, queryURL, queryString, limit, formatting)
+}
+
+// HandleLokiInstantQuery handles Loki instant query tool requests
+func HandleLokiInstantQuery(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	// Extract parameters
+	queryString, ok := request.Params.Arguments["query"].(string)
+	if !ok || queryString == "" {
+		return nil, fmt.Errorf("query parameter is required")
+	}
+	conn, err := lokiConnectionFromRequest(request)
+	if err != nil {
+		return nil, err
 	}
-	if tokenArg, ok := request.Params.Arguments["token"].(string); ok {
-		token = tokenArg
+
+	parser, err := newTimeParser()
+	if err != nil {
+		return nil, err
 	}
 
 	// Set defaults for optional parameters
-	start := time.Now().Add(-1 * time.Hour).Unix()
-	end := time.Now().Unix()
-	limit := 100
+	ts := parser.now.UnixNano()
+	limit, err := conn.queryLimit(request.Params.Arguments)
+	if err != nil {
+		return nil, err
+	}
 
 	// Override defaults if parameters are provided
-	if startStr, ok := request.Params.Arguments["start"].(string); ok && startStr != "" {
-		startTime, err := parseTime(startStr)
+	if timeStr, ok := request.Params.Arguments["time"].(string); ok && timeStr != "" {
+		evalTime, err := parser.parse(timeStr, false)
 		if err != nil {
-			return nil, fmt.Errorf("invalid start time: %v", err)
+			return nil, fmt.Errorf("invalid time: %v", err)
 		}
-		start = startTime.Unix()
+		ts = evalTime.UnixNano()
 	}
+	conn.times.recordAt(parser.loc, ts)
 
-	if endStr, ok := request.Params.Arguments["end"].(string); ok && endStr != "" {
-		endTime, err := parseTime(endStr)
-		if err != nil {
-			return nil, fmt.Errorf("invalid end time: %v", err)
-		}
-		end = endTime.Unix()
+	direction, err := directionFromRequest(request.Params.Arguments)
+	if err != nil {
+		return nil, err
 	}
 
-	if limitVal, ok := request.Params.Arguments["limit"].(float64); ok {
-		limit = int(limitVal)
+	formatting, err := conn.formatOptionsFromRequest(request.Params.Arguments)
+	if err != nil {
+		return nil, err
 	}
 
 	// Build query URL
-	queryURL, err := buildLokiQueryURL(lokiURL, queryString, start, end, limit)
+	queryURL, err := buildLokiInstantQueryURL(conn.URL, queryString, ts, limit, direction)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build query URL: %v", err)
 	}
 
-	// Execute query with authentication
-	result, err := executeLokiQuery(ctx, queryURL, username, password, token)
+	return runLokiQuery(ctx, conn, queryURL, queryString, 0, formatting)
+}
+
+// timeRangeFromRequest extracts the start and end arguments as Unix
+// timestamps in nanoseconds, defaulting to the last hour, and records the
+// resolved range for the tool result
+func (c lokiConnection) timeRangeFromRequest(request mcp.CallToolRequest) (int64, int64, error) {
+	parser, err := newTimeParser()
 	if err != nil {
-		return nil, fmt.Errorf("query execution failed: %v", err)
+		return 0, 0, err
+	}
+
+	// Set defaults for optional parameters
+	start := parser.now.Add(-1 * time.Hour).UnixNano()
+	end := parser.now.UnixNano()
+
+	// Override defaults if parameters are provided
+	if startStr, ok := request.Params.Arguments["start"].(string); ok && startStr != "" {
+		startTime, err := parser.parse(startStr, false)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid start time: %v", err)
+		}
+		start = startTime.UnixNano()
+	}
+
+	if endStr, ok := request.Params.Arguments["end"].(string); ok && endStr != "" {
+		endTime, err := parser.parse(endStr, true)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid end time: %v", err)
+		}
+		end = endTime.UnixNano()
 	}
 
-	// Format results
-	formattedResult, err := formatLokiResults(result)
+	if end < start {
+		return 0, 0, fmt.Errorf("invalid time range: end %s is before start %s", formatNanos(end), formatNanos(start))
+	}
+
+	c.times.recordRange(parser.loc, start, end)
+	return start, end, nil
+}
+
+// runLokiQuery executes a prepared query URL and formats the result for the
+// tool response. If limit is set, hitting it is reported as possible truncation.
+func runLokiQuery(ctx context.Context, conn lokiConnection, queryURL, queryString string, limit int, formatting formatOptions) (*mcp.CallToolResult, error) {
+	// Execute query with authentication
+	result, err := executeLokiQuery(ctx, queryURL, conn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to format results: %v", err)
+		return nil, fmt.Errorf("query execution failed: %v", err)
 	}
 
 	// Broadcast results to SSE clients if available
 	broadcastQueryResults(ctx, queryString, result)
 
-	return mcp.NewToolResultText(formattedResult), nil
+	var notes []string
+	if lines := countLogLines(result); limit > 0 && lines >= limit {
+		notes = append(notes, fmt.Sprintf("Note: %d lines returned, which is the limit, so more lines in the time range may be missing. Set paginate to true, raise the limit or narrow the range to see them", lines))
+	}
+
+	return conn.queryToolResult(result, formatting, notes)
+}
+
+// countLogLines returns the number of log lines in a streams result
+func countLogLines(result *LokiResult) int {
+	if result.Data.ResultType != ResultTypeStreams {
+		return 0
+	}
+	lines := 0
+	for _, stream := range result.Data.Result {
+		lines += len(stream.Values)
+	}
+	return lines
 }
 
 // broadcastQueryResults sends the query results to all connected SSE clients
@@ -175,171 +869,333 @@ func broadcastQueryResults(ctx context.Context, queryString string, result *Loki
 	// or if you decide to implement custom broadcasting later
 }
 
-// parseTime parses a time string in various formats
-func parseTime(timeStr string) (time.Time, error) {
-	// Handle "now" keyword
-	if timeStr == "now" {
-		return time.Now(), nil
+// buildLokiURL constructs the URL of a Loki API endpoint, such as
+// "query_range" or "labels", relative to the configured base URL
+func buildLokiURL(baseURL, endpoint string, params url.Values) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
 	}
 
-	// Handle relative time strings like "-1h", "-30m"
-	if len(timeStr) > 0 && timeStr[0] == '-' {
-		duration, err := time.ParseDuration(timeStr)
-		if err == nil {
-			return time.Now().Add(duration), nil
-		}
+	// Add path for Loki API only if not already included. If the path already
+	// contains loki/api/v1, replace whatever endpoint follows it.
+	if idx := strings.Index(u.Path, "loki/api/v1"); idx >= 0 {
+		u.Path = u.Path[:idx] + "loki/api/v1/" + endpoint
+	} else {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/loki/api/v1/" + endpoint
 	}
 
-	// Try parsing as RFC3339
-	t, err := time.Parse(time.RFC3339, timeStr)
-	if err == nil {
-		return t, nil
+	// Add query parameters, keeping any already present on the base URL
+	q := u.Query()
+	for key, values := range params {
+		q[key] = values
 	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// buildLokiQueryURL constructs the Loki query URL
+func buildLokiQueryURL(baseURL, query string, start, end int64, limit int, opts queryRangeOptions) (string, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", fmt.Sprintf("%d", start))
+	params.Set("end", fmt.Sprintf("%d", end))
+	params.Set("limit", fmt.Sprintf("%d", limit))
+	opts.set(params)
+
+	return buildLokiURL(baseURL, "query_range", params)
+}
 
-	// Try other common formats
-	formats := []string{
-		"2006-01-02T15:04:05",
-		"2006-01-02 15:04:05",
-		"2006-01-02",
+// buildLokiInstantQueryURL constructs the Loki instant query URL
+func buildLokiInstantQueryURL(baseURL, query string, ts int64, limit int, direction string) (string, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("time", fmt.Sprintf("%d", ts))
+	params.Set("limit", fmt.Sprintf("%d", limit))
+	params.Set("direction", direction)
+
+	return buildLokiURL(baseURL, "query", params)
+}
+
+// executeLokiQuery sends the query request to Loki and decodes the result
+func executeLokiQuery(ctx context.Context, queryURL string, conn lokiConnection) (*LokiResult, error) {
+	var result LokiResult
+	if err := executeLokiRequest(ctx, queryURL, conn, &result); err != nil {
+		return nil, err
 	}
 
-	for _, format := range formats {
-		t, err := time.Parse(format, timeStr)
-		if err == nil {
-			return t, nil
-		}
+	// Check for Loki errors
+	if result.Status == "error" {
+		return nil, fmt.Errorf("loki error: %s", result.Error)
 	}
 
-	return time.Time{}, fmt.Errorf("unsupported time format: %s", timeStr)
+	return &result, nil
 }
 
-// buildLokiQueryURL constructs the Loki query URL
-func buildLokiQueryURL(baseURL, query string, start, end int64, limit int) (string, error) {
-	u, err := url.Parse(baseURL)
-	if err != nil {
-		return "", err
-	}
+// executeLokiRequest sends the HTTP request to Loki and decodes the JSON
+// response body into v, retrying transient failures with backoff
+func executeLokiRequest(ctx context.Context, requestURL string, conn lokiConnection, v any) error {
+	policy := retryPolicyFor(conn.Retry)
+	for attempt := 1; ; attempt++ {
+		body, err := doLokiRequest(ctx, requestURL, conn)
+		if err == nil {
+			// Parse JSON response
+			return json.Unmarshal(body, v)
+		}
 
-	// Add path for Loki query API only if not already included
-	if !strings.Contains(u.Path, "loki/api/v1") {
-		if u.Path == "" || u.Path == "/" {
-			u.Path = "/loki/api/v1/query_range"
-		} else {
-			u.Path = fmt.Sprintf("%s/loki/api/v1/query_range", u.Path)
+		var retryable *retryableError
+		if !errors.As(err, &retryable) || ctx.Err() != nil {
+			return err
 		}
-	} else {
-		// If path already contains loki/api/v1, just append query_range if not present
-		if !strings.HasSuffix(u.Path, "query_range") {
-			u.Path = fmt.Sprintf("%s/query_range", u.Path)
+		if attempt >= policy.maxAttempts {
+			if attempt > 1 {
+				return fmt.Errorf("%v (gave up after %d attempts)", err, attempt)
+			}
+			return err
 		}
-	}
 
-	// Add query parameters
-	q := u.Query()
-	q.Set("query", query)
-	q.Set("start", fmt.Sprintf("%d", start))
-	q.Set("end", fmt.Sprintf("%d", end))
-	q.Set("limit", fmt.Sprintf("%d", limit))
-	u.RawQuery = q.Encode()
+		delay := policy.backoff(attempt)
+		if retryable.hasRetryAfter {
+			// Waiting longer than the maximum backoff would stall the tool call
+			if retryable.retryAfter > policy.maxBackoff {
+				return fmt.Errorf("%v (Loki asked to retry after %s)", err, retryable.retryAfter)
+			}
+			delay = retryable.retryAfter
+		}
+		if !conn.deadline.IsZero() && time.Now().Add(delay).After(conn.deadline) {
+			return fmt.Errorf("%v (not retried: the timeout of %s would pass first, raise it with the timeout argument)", err, conn.Timeout)
+		}
+		conn.retries.record(retryable.reason)
 
-	return u.String(), nil
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// callContext bounds ctx by the deadline of the tool call, so that retries
+// and pages together cannot run past the timeout. A connection without a
+// deadline bounds the request by its timeout alone.
+func (c lokiConnection) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if !c.deadline.IsZero() {
+		return context.WithDeadline(ctx, c.deadline)
+	}
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
 }
 
-// executeLokiQuery sends the HTTP request to Loki
-func executeLokiQuery(ctx context.Context, queryURL string, username, password, token string) (*LokiResult, error) {
+// doLokiRequest makes a single attempt of a GET request to Loki and returns
+// the response body. Failures worth retrying are returned as *retryableError.
+func doLokiRequest(ctx context.Context, requestURL string, conn lokiConnection) ([]byte, error) {
+	requestCtx, cancel := conn.callContext(ctx)
+	defer cancel()
+	timeout := conn.Timeout
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+
 	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "GET", queryURL, nil)
+	req, err := http.NewRequestWithContext(requestCtx, "GET", requestURL, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	// Add authentication if provided
-	if token != "" {
-		// Bearer token authentication
-		req.Header.Add("Authorization", "Bearer "+token)
-	} else if username != "" || password != "" {
-		// Basic authentication
-		req.SetBasicAuth(username, password)
+	if err := conn.applyHeaders(req.Header); err != nil {
+		return nil, err
 	}
 
-	// Execute request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	// Execute request using the shared client for the connection's settings
+	client, err := httpClientFor(conn.TLS, conn.HTTP)
+	if err != nil {
+		return nil, err
 	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, transportError(ctx, requestCtx, timeout, err)
 	}
 	defer resp.Body.Close()
 
 	// Read response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, transportError(ctx, requestCtx, timeout, err)
 	}
 
 	// Check for HTTP errors
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP error: %d - %s", resp.StatusCode, string(body))
+		err := fmt.Errorf("HTTP error: %d - %s", resp.StatusCode, string(body))
+		if !retryableStatus(resp.StatusCode) {
+			return nil, err
+		}
+		retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		return nil, &retryableError{
+			err:           err,
+			reason:        fmt.Sprintf("HTTP %d", resp.StatusCode),
+			retryAfter:    retryAfter,
+			hasRetryAfter: ok,
+		}
 	}
 
-	// Parse JSON response
-	var result LokiResult
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
+	return body, nil
+}
 
-	// Check for Loki errors
-	if result.Status == "error" {
-		return nil, fmt.Errorf("loki error: %s", result.Error)
+// transportError classifies an error from sending a request or reading the
+// response: dropped connections are retryable, and a request that hit its own
+// timeout, rather than being cancelled by the caller, gets a hint on how to
+// raise the timeout
+func transportError(ctx, requestCtx context.Context, timeout time.Duration, err error) error {
+	if ctx.Err() == nil && errors.Is(requestCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("tool call timed out after %s (raise it with the timeout argument): %v", timeout, err)
 	}
-
-	return &result, nil
+	if ctx.Err() == nil && retryableNetworkError(err) {
+		return &retryableError{err: err, reason: "connection error"}
+	}
+	return err
 }
 
 // formatLokiResults formats the Loki query results into a readable string
 func formatLokiResults(result *LokiResult) (string, error) {
-	if len(result.Data.Result) == 0 {
-		return "No logs found matching the query", nil
-	}
-
-	var output string
-	output = fmt.Sprintf("Found %d streams:\n\n", len(result.Data.Result))
-
-	for i, entry := range result.Data.Result {
-		// Format stream labels
-		streamInfo := "Stream "
-		if len(entry.Stream) > 0 {
-			streamInfo += "("
-			first := true
-			for k, v := range entry.Stream {
-				if !first {
-					streamInfo += ", "
-				}
-				streamInfo += fmt.Sprintf("%s=%s", k, v)
-				first = false
-			}
-			streamInfo += ")"
-		}
-
-		output += fmt.Sprintf("%s %d:\n", streamInfo, i+1)
-
-		// Format log entries
-		for _, val := range entry.Values {
-			if len(val) >= 2 {
-				// Parse timestamp
-				ts, err := strconv.ParseFloat(val[0], 64)
-				if err == nil {
-					// Convert to time - Loki returns timestamps in nanoseconds already
-					timestamp := time.Unix(0, int64(ts))
-					output += fmt.Sprintf("[%s] %s\n", timestamp.Format(time.RFC3339), val[1])
-				} else {
-					output += fmt.Sprintf("[%s] %s\n", val[0], val[1])
-				}
+	return formatLokiResultsWithOptions(result, formatOptions{})
+}
+
+// formatLokiResultsWithOptions formats the Loki query results into a
+// readable string, showing the labels selected by the options
+func formatLokiResultsWithOptions(result *LokiResult, opts formatOptions) (string, error) {
+	switch result.Data.ResultType {
+	case ResultTypeMatrix, ResultTypeVector:
+		return formatMetricResults(result.Data.Metrics, opts), nil
+	case ResultTypeScalar:
+		if result.Data.Scalar == nil {
+			return "No data found matching the query", nil
+		}
+		return fmt.Sprintf("Scalar result: [%s] %s\n", result.Data.Scalar.Time().In(opts.location()).Format(time.RFC3339Nano), result.Data.Scalar.Value), nil
+	default:
+		return formatStreamResults(result.Data.Result, opts), nil
+	}
+}
+
+// formatStreamResults formats log stream results. The lines are collected
+// first, so a result over the output budget only renders the lines it keeps.
+func formatStreamResults(streams []LokiEntry, opts formatOptions) string {
+	if len(streams) == 0 {
+		return "No logs found matching the query"
+	}
+
+	sets := make([]map[string]string, len(streams))
+	for i, entry := range streams {
+		sets[i] = entry.Stream
+	}
+	headers, common := opts.labelHeaders(sets)
+
+	prefix := fmt.Sprintf("Found %d streams:\n\n", len(streams))
+	if len(common) > 0 {
+		prefix += fmt.Sprintf("Common labels: %s\n\n", formatLabelPairs(common))
+	}
+
+	var lines []streamLine
+	streamHeaders := make([]string, len(streams))
+	size := len(prefix)
+	shortened := 0
+	loc := opts.location()
+	for i, entry := range streams {
+		streamHeaders[i] = fmt.Sprintf("%s %d", formatLabels("Stream", headers[i]), i+1)
+		size += len(streamHeaders[i]) + 3
+
+		// Format log entries, collapsing repeated lines if requested
+		for _, group := range dedupLines(entry.Values, opts.Dedup) {
+			line, cut := opts.truncateLine(group.line)
+			if cut {
+				shortened++
 			}
+			text := group.format(line, loc)
+			size += len(text) + 1
+			lines = append(lines, streamLine{stream: i, text: text})
+		}
+	}
+
+	dedupNote := collapsedNote(streams, len(lines), opts.Dedup)
+
+	// Keep the first and last lines of a result over the output budget and
+	// summarize what was left out
+	var b strings.Builder
+	b.WriteString(prefix)
+	if opts.MaxOutputBytes <= 0 || size <= opts.MaxOutputBytes {
+		b.Grow(size - len(prefix) + len(dedupNote))
+		writeStreamLines(&b, streamHeaders, lines)
+		if opts.MaxOutputBytes <= 0 || shortened == 0 {
+			b.WriteString(dedupNote)
+			return b.String()
+		}
+	}
+	elided := 0
+	if size > opts.MaxOutputBytes {
+		var body string
+		body, elided = elideStreamLines(lines, streamHeaders, opts.MaxOutputBytes-len(prefix)-summaryReserve)
+		b.WriteString(body)
+	}
+	b.WriteString(streamSummary(streams, opts, len(lines), elided, shortened))
+	if dedupNote != "" {
+		b.WriteString("\n" + dedupNote)
+	}
+	return b.String()
+}
+
+// formatMetricResults formats matrix and vector results as time series. The
+// lines are collected first, so a result over the output budget only renders
+// the lines it keeps.
+func formatMetricResults(metrics []LokiMetric, opts formatOptions) string {
+	if len(metrics) == 0 {
+		return "No series found matching the query"
+	}
+
+	sets := make([]map[string]string, len(metrics))
+	for i, metric := range metrics {
+		sets[i] = metric.Metric
+	}
+	headers, common := opts.labelHeaders(sets)
+
+	lines := []string{fmt.Sprintf("Found %d series:", len(metrics)), ""}
+	if len(common) > 0 {
+		lines = append(lines, fmt.Sprintf("Common labels: %s", formatLabelPairs(common)), "")
+	}
+
+	loc := opts.location()
+	samples := 0
+	for i, metric := range metrics {
+		lines = append(lines, fmt.Sprintf("%s %d:", formatLabels("Series", headers[i]), i+1))
+
+		values := metric.Values
+		if metric.Value != nil {
+			values = []LokiSample{*metric.Value}
+		}
+		for _, sample := range values {
+			lines = append(lines, fmt.Sprintf("[%s] %s", sample.Time().In(loc).Format(time.RFC3339Nano), sample.Value))
 		}
-		output += "\n"
+		samples += len(values)
+		lines = append(lines, "")
+	}
+
+	output, elided := elideLines(lines, opts.MaxOutputBytes-summaryReserve)
+	if opts.MaxOutputBytes > 0 && elided > 0 {
+		output += fmt.Sprintf("\nSummary: %d samples in %d series\nOutput limited to %d bytes: %d lines elided. Narrow the query or raise max_output_bytes to see everything", samples, len(metrics), opts.MaxOutputBytes, elided)
 	}
+	return output
+}
 
-	return output, nil
+// formatLabels formats a label set as "<prefix> (k=v, ...)" with the labels
+// sorted by name, so the output is the same on every run
+func formatLabels(prefix string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return prefix
+	}
+	return fmt.Sprintf("%s (%s)", prefix, formatLabelPairs(labels))
 }
@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
 )
 
 // TestFormatLokiResults_TimestampParsing tests that timestamps from Loki are correctly parsed
@@ -258,3 +264,371 @@ func TestFormatLokiResults_NoYear2262Bug(t *testing.T) {
 		})
 	}
 }
+
+// TestLokiData_UnmarshalResultTypes tests that every Loki result type is decoded into the right field
+func TestLokiData_UnmarshalResultTypes(t *testing.T) {
+	testCases := []struct {
+		name  string
+		body  string
+		check func(t *testing.T, data LokiData)
+	}{
+		{
+			name: "streams",
+			body: `{"status":"success","data":{"resultType":"streams","result":[{"stream":{"job":"api"},"values":[["1705312245000000000","hello"]]}]}}`,
+			check: func(t *testing.T, data LokiData) {
+				if len(data.Result) != 1 || data.Result[0].Values[0][1] != "hello" {
+					t.Errorf("Unexpected streams result: %+v", data.Result)
+				}
+			},
+		},
+		{
+			name: "matrix",
+			body: `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"app":"api"},"values":[[1705312245,"1.5"],[1705312260.5,"2"]]}]}}`,
+			check: func(t *testing.T, data LokiData) {
+				if len(data.Metrics) != 1 || len(data.Metrics[0].Values) != 2 {
+					t.Fatalf("Unexpected matrix result: %+v", data.Metrics)
+				}
+				if data.Metrics[0].Values[1].Value != "2" || data.Metrics[0].Values[1].Timestamp != 1705312260.5 {
+					t.Errorf("Unexpected sample: %+v", data.Metrics[0].Values[1])
+				}
+			},
+		},
+		{
+			name: "vector",
+			body: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1705312245.123,"42"]}]}}`,
+			check: func(t *testing.T, data LokiData) {
+				if len(data.Metrics) != 1 || data.Metrics[0].Value == nil || data.Metrics[0].Value.Value != "42" {
+					t.Errorf("Unexpected vector result: %+v", data.Metrics)
+				}
+			},
+		},
+		{
+			name: "scalar",
+			body: `{"status":"success","data":{"resultType":"scalar","result":[1705312245,"7"]}}`,
+			check: func(t *testing.T, data LokiData) {
+				if data.Scalar == nil || data.Scalar.Value != "7" {
+					t.Errorf("Unexpected scalar result: %+v", data.Scalar)
+				}
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var result LokiResult
+			if err := json.Unmarshal([]byte(tc.body), &result); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if result.Data.ResultType != tc.name {
+				t.Errorf("Expected result type %s, got %s", tc.name, result.Data.ResultType)
+			}
+			tc.check(t, result.Data)
+		})
+	}
+}
+
+// TestFormatLokiResults_Matrix tests that matrix results are rendered as time series
+func TestFormatLokiResults_Matrix(t *testing.T) {
+	result := &LokiResult{
+		Status: "success",
+		Data: LokiData{
+			ResultType: ResultTypeMatrix,
+			Metrics: []LokiMetric{
+				{
+					Metric: map[string]string{"app": "api"},
+					Values: []LokiSample{
+						{Timestamp: 1705312245, Value: "0.5"},
+						{Timestamp: 1705312260, Value: "1.25"},
+					},
+				},
+			},
+		},
+	}
+
+	output, err := formatLokiResults(result)
+	if err != nil {
+		t.Fatalf("formatLokiResults failed: %v", err)
+	}
+
+	for _, expected := range []string{"Found 1 series", "Series (app=api) 1:", "] 0.5", "] 1.25", "2024-01-15T"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, but got:\n%s", expected, output)
+		}
+	}
+}
+
+// TestFormatLokiResults_VectorAndScalar tests rendering of instant metric results
+func TestFormatLokiResults_VectorAndScalar(t *testing.T) {
+	vector := &LokiResult{
+		Data: LokiData{
+			ResultType: ResultTypeVector,
+			Metrics: []LokiMetric{
+				{Metric: map[string]string{"level": "error"}, Value: &LokiSample{Timestamp: 1705312245, Value: "17"}},
+			},
+		},
+	}
+	output, err := formatLokiResults(vector)
+	if err != nil {
+		t.Fatalf("formatLokiResults failed: %v", err)
+	}
+	if !strings.Contains(output, "Series (level=error) 1:") || !strings.Contains(output, "] 17") {
+		t.Errorf("Unexpected vector output:\n%s", output)
+	}
+
+	scalar := &LokiResult{
+		Data: LokiData{
+			ResultType: ResultTypeScalar,
+			Scalar:     &LokiSample{Timestamp: 1705312245, Value: "3"},
+		},
+	}
+	output, err = formatLokiResults(scalar)
+	if err != nil {
+		t.Fatalf("formatLokiResults failed: %v", err)
+	}
+	if !strings.HasPrefix(output, "Scalar result: [2024-01-15T") || !strings.Contains(output, "] 3") {
+		t.Errorf("Unexpected scalar output:\n%s", output)
+	}
+
+	empty := &LokiResult{Data: LokiData{ResultType: ResultTypeMatrix}}
+	output, err = formatLokiResults(empty)
+	if err != nil {
+		t.Fatalf("formatLokiResults failed: %v", err)
+	}
+	if output != "No series found matching the query" {
+		t.Errorf("Unexpected empty output: %q", output)
+	}
+}
+
+// TestBuildLokiURL tests that endpoint paths are appended to the various base URL shapes
+func TestBuildLokiURL(t *testing.T) {
+	testCases := []struct {
+		baseURL  string
+		expected string
+	}{
+		{"http://localhost:3100", "http://localhost:3100/loki/api/v1/query"},
+		{"http://localhost:3100/", "http://localhost:3100/loki/api/v1/query"},
+		{"http://gateway/prefix", "http://gateway/prefix/loki/api/v1/query"},
+		{"http://localhost:3100/loki/api/v1", "http://localhost:3100/loki/api/v1/query"},
+		{"http://localhost:3100/loki/api/v1/query_range", "http://localhost:3100/loki/api/v1/query"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.baseURL, func(t *testing.T) {
+			got, err := buildLokiURL(tc.baseURL, "query", nil)
+			if err != nil {
+				t.Fatalf("buildLokiURL failed: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+// newCallToolRequest builds a tool request with the given arguments
+func newCallToolRequest(args map[string]any) mcp.CallToolRequest {
+	var request mcp.CallToolRequest
+	request.Params.Arguments = args
+	return request
+}
+
+// resultText returns the text content of a tool result
+func resultText(t *testing.T, result *mcp.CallToolResult) string {
+	t.Helper()
+	if result == nil || len(result.Content) == 0 {
+		t.Fatalf("Expected tool result content, got %+v", result)
+	}
+	text, ok := mcp.AsTextContent(result.Content[0])
+	if !ok {
+		t.Fatalf("Expected text content, got %T", result.Content[0])
+	}
+	return text.Text
+}
+
+// TestHandleLokiInstantQuery tests that instant queries hit /loki/api/v1/query with the expected parameters
+func TestHandleLokiInstantQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/query" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("query") != `count_over_time({app="api"}[5m])` {
+			t.Errorf("Unexpected query: %s", q.Get("query"))
+		}
+		if q.Get("time") != "1705312245000000000" {
+			t.Errorf("Unexpected time: %s", q.Get("time"))
+		}
+		if q.Get("direction") != "forward" || q.Get("limit") != "10" {
+			t.Errorf("Unexpected direction/limit: %s/%s", q.Get("direction"), q.Get("limit"))
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			t.Errorf("Expected basic auth, got %s/%s", user, pass)
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"app":"api"},"value":[1705312245,"12"]}]}}`))
+	}))
+	defer server.Close()
+
+	result, err := HandleLokiInstantQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query":     `count_over_time({app="api"}[5m])`,
+		"url":       server.URL,
+		"username":  "admin",
+		"password":  "secret",
+		"time":      "2024-01-15T09:50:45Z",
+		"direction": "forward",
+		"limit":     float64(10),
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiInstantQuery failed: %v", err)
+	}
+
+	output := resultText(t, result)
+	if !strings.Contains(output, "Series (app=api) 1:") || !strings.Contains(output, "] 12") {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+}
+
+// TestHandleLokiInstantQuery_InvalidDirection tests that unknown directions are rejected
+func TestHandleLokiInstantQuery_InvalidDirection(t *testing.T) {
+	_, err := HandleLokiInstantQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query":     `{app="api"}`,
+		"direction": "sideways",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "invalid direction") {
+		t.Errorf("Expected invalid direction error, got %v", err)
+	}
+}
+
+// TestHandleLokiQuery_OrgID tests that the tenant is sent as X-Scope-OrgID from the argument or the environment
+func TestHandleLokiQuery_OrgID(t *testing.T) {
+	var gotOrgID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotOrgID = r.Header.Get("X-Scope-OrgID")
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[]}}`))
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiOrgID, "platform")
+
+	testCases := []struct {
+		name     string
+		orgID    any
+		expected string
+	}{
+		{"environment default", nil, "platform"},
+		{"argument overrides environment", "team-a", "team-a"},
+		{"federated tenants", " team-a | team-b|team-a ", "team-a|team-b"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := map[string]any{"query": `{app="api"}`, "url": server.URL}
+			if tc.orgID != nil {
+				args["org_id"] = tc.orgID
+			}
+
+			if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(args)); err != nil {
+				t.Fatalf("HandleLokiQuery failed: %v", err)
+			}
+			if gotOrgID != tc.expected {
+				t.Errorf("Expected X-Scope-OrgID %q, got %q", tc.expected, gotOrgID)
+			}
+		})
+	}
+}
+
+// TestNormalizeOrgID_Invalid tests that malformed tenant IDs are rejected before reaching Loki
+func TestNormalizeOrgID_Invalid(t *testing.T) {
+	for _, orgID := range []string{"team-a||team-b", "|", "..", "team a", "team/a", strings.Repeat("x", 151)} {
+		if _, err := normalizeOrgID(orgID); err == nil {
+			t.Errorf("Expected org_id %q to be rejected", orgID)
+		}
+	}
+}
+
+// TestParseTime_Epoch tests raw Unix timestamps in seconds, milliseconds, microseconds and nanoseconds
+func TestParseTime_Epoch(t *testing.T) {
+	testCases := map[string]int64{
+		"1705312245":                     1705312245000000000,
+		"1705312245.5":                   1705312245500000000,
+		"1705312245.123456789":           1705312245123456789,
+		"1705312245123":                  1705312245123000000,
+		"1705312245123456":               1705312245123456000,
+		"1705312245123456789":            1705312245123456789,
+		"2024-01-15T09:50:45.123456789Z": 1705312245123456789,
+	}
+
+	for value, expected := range testCases {
+		parsed, err := parseTime(value)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", value, err)
+		} else if parsed.UnixNano() != expected {
+			t.Errorf("%s: expected %d, got %d", value, expected, parsed.UnixNano())
+		}
+	}
+
+	for _, value := range []string{"1705312245x", "1705312245.", "17053122451.5", "1705312245.1234567891"} {
+		if _, err := parseTime(value); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
+
+// TestFormatLokiResults_NanosecondRoundTrip tests that a printed timestamp parses back to the exact nanosecond
+func TestFormatLokiResults_NanosecondRoundTrip(t *testing.T) {
+	result := &LokiResult{
+		Data: LokiData{
+			ResultType: ResultTypeStreams,
+			Result: []LokiEntry{
+				{Stream: map[string]string{"app": "api"}, Values: [][]string{{"1705312245123456789", "request failed"}}},
+			},
+		},
+	}
+
+	output, err := formatLokiResults(result)
+	if err != nil {
+		t.Fatalf("formatLokiResults failed: %v", err)
+	}
+
+	start := strings.Index(output, "[")
+	end := strings.Index(output, "] request failed")
+	if start < 0 || end < 0 {
+		t.Fatalf("Timestamp not found in:\n%s", output)
+	}
+	parsed, err := parseTime(output[start+1 : end])
+	if err != nil {
+		t.Fatalf("Printed timestamp does not parse: %v", err)
+	}
+	if parsed.UnixNano() != 1705312245123456789 {
+		t.Errorf("Expected 1705312245123456789, got %d", parsed.UnixNano())
+	}
+}
+
+// TestHandleLokiQuery_NanosecondRange tests that start and end are sent to Loki with nanosecond precision
+func TestHandleLokiQuery_NanosecondRange(t *testing.T) {
+	var last *http.Request
+	server := recordingLokiServer(t, &last)
+
+	_, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query": `{app="api"}`,
+		"url":   server.URL,
+		"start": "1705312245123456789",
+		"end":   "2024-01-15T09:50:46.000000001Z",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if q := last.URL.Query(); q.Get("start") != "1705312245123456789" || q.Get("end") != "1705312246000000001" {
+		t.Errorf("Unexpected range: start=%s end=%s", q.Get("start"), q.Get("end"))
+	}
+
+	// An inverted range is rejected before querying Loki
+	_, err = HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query": `{app="api"}`,
+		"url":   server.URL,
+		"start": "1705312246",
+		"end":   "1705312245",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "is before start") {
+		t.Errorf("Expected invalid range error, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
+)
+
+// Shared OAuth2 token sources keyed by their settings, so that tokens are
+// cached across tool calls and only refreshed when they expire
+var (
+	tokenSourcesMu sync.Mutex
+	tokenSources   = make(map[string]oauth2.TokenSource)
+)
+
+// oauth2Token returns a valid access token for the OAuth2 settings,
+// requesting a new one from the token endpoint only when needed
+func oauth2Token(cfg *config.OAuth2Config, tlsSettings config.TLSConfig, httpSettings config.HTTPConfig) (*oauth2.Token, error) {
+	tokenSource, err := oauth2TokenSource(cfg, tlsSettings, httpSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := tokenSource.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain oauth2 token: %v", err)
+	}
+	return token, nil
+}
+
+// oauth2TokenSource returns the shared token source for the OAuth2 settings,
+// creating it on first use
+func oauth2TokenSource(cfg *config.OAuth2Config, tlsSettings config.TLSConfig, httpSettings config.HTTPConfig) (oauth2.TokenSource, error) {
+	secret, err := cfg.Secret()
+	if err != nil {
+		return nil, err
+	}
+
+	endpointParams := url.Values{}
+	for key, value := range cfg.EndpointParams {
+		endpointParams.Set(key, value)
+	}
+
+	// The secret is part of the key so a rotated secret gets a fresh token
+	scopes := append([]string(nil), cfg.Scopes...)
+	sort.Strings(scopes)
+	key := strings.Join([]string{cfg.TokenURL, cfg.ClientID, secret, strings.Join(scopes, " "), endpointParams.Encode(), fmt.Sprintf("%+v %+v", tlsSettings, httpSettings)}, "\x00")
+
+	tokenSourcesMu.Lock()
+	defer tokenSourcesMu.Unlock()
+
+	if tokenSource, ok := tokenSources[key]; ok {
+		return tokenSource, nil
+	}
+
+	// Reach the token endpoint with the same TLS and HTTP settings as Loki
+	shared, err := httpClientFor(tlsSettings, httpSettings)
+	if err != nil {
+		return nil, err
+	}
+	timeout := httpSettings.Timeout
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+	client := &http.Client{Transport: shared.Transport, Timeout: timeout}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+
+	credentials := clientcredentials.Config{
+		ClientID:       cfg.ClientID,
+		ClientSecret:   secret,
+		TokenURL:       cfg.TokenURL,
+		Scopes:         cfg.Scopes,
+		EndpointParams: endpointParams,
+	}
+	tokenSource := credentials.TokenSource(ctx)
+	tokenSources[key] = tokenSource
+	return tokenSource, nil
+}
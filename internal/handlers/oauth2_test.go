@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
+)
+
+// newTokenServer starts a fake OAuth2 token endpoint that issues numbered
+// tokens valid for expiresIn seconds and counts the tokens it issued
+func newTokenServer(t *testing.T, expiresIn int, issued *int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Form.Get("grant_type") != "client_credentials" {
+			http.Error(w, "unsupported grant type", http.StatusBadRequest)
+			return
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "loki-mcp" || pass != "client-secret" {
+			http.Error(w, "invalid client", http.StatusUnauthorized)
+			return
+		}
+		if scope := r.Form.Get("scope"); scope != "logs:read" {
+			http.Error(w, "unexpected scope "+scope, http.StatusBadRequest)
+			return
+		}
+
+		n := atomic.AddInt32(issued, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d}`, n, expiresIn)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestLokiQuery_OAuth2 tests that tokens are fetched with the client-credentials grant and reused across calls
+func TestLokiQuery_OAuth2(t *testing.T) {
+	var issued int32
+	tokenServer := newTokenServer(t, 3600, &issued)
+
+	var last *http.Request
+	loki := recordingLokiServer(t, &last)
+
+	useConfig(t, &config.Config{
+		Datasources: []config.Datasource{{
+			Name: "prod",
+			URL:  loki.URL,
+			OAuth2: &config.OAuth2Config{
+				TokenURL:     tokenServer.URL,
+				ClientID:     "loki-mcp",
+				ClientSecret: "client-secret",
+				Scopes:       []string{"logs:read"},
+			},
+		}},
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`})); err != nil {
+			t.Fatalf("HandleLokiQuery failed: %v", err)
+		}
+		if auth := last.Header.Get("Authorization"); auth != "Bearer token-1" {
+			t.Errorf("Expected the cached token, got %q", auth)
+		}
+	}
+	if issued != 1 {
+		t.Errorf("Expected 1 token request, got %d", issued)
+	}
+}
+
+// TestLokiQuery_OAuth2Refresh tests that an expired token is replaced with a new one
+func TestLokiQuery_OAuth2Refresh(t *testing.T) {
+	var issued int32
+	// Tokens expiring within the oauth2 package's expiry delta are refreshed immediately
+	tokenServer := newTokenServer(t, 1, &issued)
+
+	var last *http.Request
+	loki := recordingLokiServer(t, &last)
+
+	t.Setenv(EnvLokiURL, loki.URL)
+	t.Setenv(config.EnvLokiOAuth2TokenURL, tokenServer.URL)
+	t.Setenv(config.EnvLokiOAuth2ClientID, "loki-mcp")
+	t.Setenv(config.EnvLokiOAuth2ClientSecret, "client-secret")
+	t.Setenv(config.EnvLokiOAuth2Scopes, "logs:read")
+
+	for i := 1; i <= 2; i++ {
+		if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`})); err != nil {
+			t.Fatalf("HandleLokiQuery failed: %v", err)
+		}
+		if auth := last.Header.Get("Authorization"); auth != fmt.Sprintf("Bearer token-%d", i) {
+			t.Errorf("Expected a fresh token, got %q", auth)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestLokiQuery_OAuth2Error tests that a failing token endpoint is reported
+func TestLokiQuery_OAuth2Error(t *testing.T) {
+	var issued int32
+	tokenServer := newTokenServer(t, 3600, &issued)
+
+	useConfig(t, &config.Config{
+		Datasources: []config.Datasource{{
+			Name: "prod",
+			URL:  "http://127.0.0.1:0",
+			OAuth2: &config.OAuth2Config{
+				TokenURL:     tokenServer.URL,
+				ClientID:     "loki-mcp",
+				ClientSecret: "wrong-secret",
+				Scopes:       []string{"logs:read"},
+			},
+		}},
+	})
+
+	_, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`}))
+	if err == nil || !strings.Contains(err.Error(), "failed to obtain oauth2 token") {
+		t.Errorf("Expected oauth2 token error, got %v", err)
+	}
+}
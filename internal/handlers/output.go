@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Output formats of the query tools
+const (
+	OutputFormatText     = "text"
+	OutputFormatJSON     = "json"
+	OutputFormatNDJSON   = "ndjson"
+	OutputFormatMarkdown = "markdown"
+	OutputFormatCSV      = "csv"
+)
+
+// QueryResultURI identifies the JSON resource attached to query results in
+// the json output format
+const QueryResultURI = "loki://query/result"
+
+var outputFormats = []string{OutputFormatText, OutputFormatJSON, OutputFormatNDJSON, OutputFormatMarkdown, OutputFormatCSV}
+
+// QueryOutput is the machine-readable form of a query result. Exactly one of
+// Streams, Series and Scalar is set, depending on ResultType.
+type QueryOutput struct {
+	ResultType string         `json:"result_type"`
+	Streams    []StreamOutput `json:"streams,omitempty"`
+	Series     []SeriesOutput `json:"series,omitempty"`
+	Scalar     *SampleOutput  `json:"scalar,omitempty"`
+	// Range is the absolute time range or evaluation time that was queried
+	Range *RangeOutput `json:"range,omitempty"`
+	// Notes are remarks such as possible truncation or retries, as in the
+	// text output
+	Notes []string `json:"notes,omitempty"`
+}
+
+// StreamOutput is a log stream and its entries
+type StreamOutput struct {
+	Labels  map[string]string `json:"labels"`
+	Entries []EntryOutput     `json:"entries"`
+}
+
+// EntryOutput is a single log line. TimestampNs is a string because
+// nanosecond timestamps do not fit in a JSON number without losing precision.
+//
+// With dedup, an entry stands for a group of repeated lines: Line is the
+// first line of the group in result order and Timestamp and TimestampNs are
+// its own, so they select exactly that entry in Loki. Count, FirstSeen and
+// LastSeen, the earliest and latest time of any line in the group, are set
+// for every entry.
+type EntryOutput struct {
+	Timestamp   string `json:"timestamp"`
+	TimestampNs string `json:"timestamp_ns"`
+	Line        string `json:"line"`
+	Count       int    `json:"count,omitempty"`
+	FirstSeen   string `json:"first_seen,omitempty"`
+	LastSeen    string `json:"last_seen,omitempty"`
+}
+
+// SeriesOutput is a metric series and its samples
+type SeriesOutput struct {
+	Labels  map[string]string `json:"labels"`
+	Samples []SampleOutput    `json:"samples"`
+}
+
+// SampleOutput is a single metric sample. Value is kept as a string, as
+// returned by Loki, so it is not rounded.
+type SampleOutput struct {
+	Timestamp string `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// RangeOutput is the time range of a range query, or the evaluation time of
+// an instant query
+type RangeOutput struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	Time  string `json:"time,omitempty"`
+}
+
+// outputFormatOption returns the schema option selecting the output format
+func outputFormatOption() mcp.ToolOption {
+	return mcp.WithString("output_format",
+		mcp.Description("Format of the result: text for reading, or json, ndjson, markdown or csv. The json result is attached as a JSON resource with a stable schema, and each format sends the data once (default: text)"),
+		mcp.Enum(outputFormats...),
+	)
+}
+
+// outputFormatFromRequest returns the output_format argument, defaulting to text
+func outputFormatFromRequest(args map[string]any) (string, error) {
+	format, ok := args["output_format"].(string)
+	if !ok || format == "" {
+		return OutputFormatText, nil
+	}
+	format = strings.ToLower(format)
+	for _, f := range outputFormats {
+		if format == f {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("invalid output_format %q: must be one of %s", format, strings.Join(outputFormats, ", "))
+}
+
+// queryToolResult formats a query result in the requested format. The data
+// is sent once. Notes about the result, the queried time range and any
+// retries are appended to text and markdown output. For the other formats
+// they follow a summary of the result in a separate text content, so the
+// data stays parseable.
+//
+// json results are attached as an embedded JSON resource, since mcp-go
+// v0.18.0 has no structuredContent, and the text content only summarizes
+// them. ndjson and csv results are the first text content.
+//
+// The output budget applies to every format: long lines are shortened and
+// the middle entries of a large result are dropped, with a note saying so.
+func (c lokiConnection) queryToolResult(result *LokiResult, opts formatOptions, notes []string) (*mcp.CallToolResult, error) {
+	format := opts.Format
+	if format == "" || format == OutputFormatText {
+		text, err := formatLokiResultsWithOptions(result, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to format results: %v", err)
+		}
+		for _, note := range notes {
+			text = strings.TrimRight(text, "\n") + "\n\n" + note
+		}
+		return c.toolResultText(text), nil
+	}
+
+	output := newQueryOutput(result, opts.Dedup)
+	output.Range = c.times.output()
+	output.Notes = append(append([]string(nil), notes...), c.notes()...)
+	if note := collapsedNote(result.Data.Result, output.entries(), opts.Dedup); note != "" {
+		output.Notes = append(output.Notes, note)
+	}
+	if note := limitQueryOutput(&output, opts); note != "" {
+		output.Notes = append(output.Notes, note)
+	}
+
+	summary := output.summary() + "."
+	if format == OutputFormatJSON {
+		summary += fmt.Sprintf(" The result is attached as JSON in the %s resource.", QueryResultURI)
+	}
+	if len(output.Notes) > 0 {
+		summary += "\n\n" + strings.Join(output.Notes, "\n")
+	}
+
+	switch format {
+	case OutputFormatJSON:
+		structured, err := json.Marshal(output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to format results: %v", err)
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{
+			mcp.NewTextContent(summary),
+			mcp.NewEmbeddedResource(mcp.TextResourceContents{
+				URI:      QueryResultURI,
+				MIMEType: "application/json",
+				Text:     string(structured),
+			}),
+		}}, nil
+	case OutputFormatMarkdown:
+		return mcp.NewToolResultText(formatMarkdown(output, opts)), nil
+	default:
+		text, err := formatQueryOutput(output, format, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to format results: %v", err)
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{mcp.NewTextContent(text), mcp.NewTextContent(summary)}}, nil
+	}
+}
+
+// summary describes the size of the result, e.g. "Found 2 streams with 40 entries"
+func (o QueryOutput) summary() string {
+	switch {
+	case o.Scalar != nil:
+		return fmt.Sprintf("Scalar result: %s at %s", o.Scalar.Value, o.Scalar.Timestamp)
+	case o.ResultType == ResultTypeMatrix || o.ResultType == ResultTypeVector:
+		samples := 0
+		for _, series := range o.Series {
+			samples += len(series.Samples)
+		}
+		return fmt.Sprintf("Found %d series with %d samples", len(o.Series), samples)
+	case o.ResultType == ResultTypeScalar:
+		return "No data found matching the query"
+	default:
+		return fmt.Sprintf("Found %d streams with %d entries", len(o.Streams), o.entries())
+	}
+}
+
+// entries returns the number of log entries in all streams
+func (o QueryOutput) entries() int {
+	entries := 0
+	for _, stream := range o.Streams {
+		entries += len(stream.Entries)
+	}
+	return entries
+}
+
+// collapsed reports whether the entries are groups of lines collapsed by dedup
+func (o QueryOutput) collapsed() bool {
+	for _, stream := range o.Streams {
+		if len(stream.Entries) > 0 {
+			return stream.Entries[0].Count > 0
+		}
+	}
+	return false
+}
+
+// newQueryOutput converts a Loki result to its machine-readable form,
+// collapsing repeated log lines by the dedup mode
+func newQueryOutput(result *LokiResult, dedup string) QueryOutput {
+	output := QueryOutput{ResultType: result.Data.ResultType}
+
+	switch result.Data.ResultType {
+	case ResultTypeMatrix, ResultTypeVector:
+		output.Series = make([]SeriesOutput, 0, len(result.Data.Metrics))
+		for _, metric := range result.Data.Metrics {
+			samples := metric.Values
+			if metric.Value != nil {
+				samples = []LokiSample{*metric.Value}
+			}
+			series := SeriesOutput{Labels: nonNilLabels(metric.Metric), Samples: make([]SampleOutput, 0, len(samples))}
+			for _, sample := range samples {
+				series.Samples = append(series.Samples, newSampleOutput(sample))
+			}
+			output.Series = append(output.Series, series)
+		}
+	case ResultTypeScalar:
+		if result.Data.Scalar != nil {
+			sample := newSampleOutput(*result.Data.Scalar)
+			output.Scalar = &sample
+		}
+	default:
+		output.ResultType = ResultTypeStreams
+		output.Streams = make([]StreamOutput, 0, len(result.Data.Result))
+		for _, entry := range result.Data.Result {
+			groups := dedupLines(entry.Values, dedup)
+			stream := StreamOutput{Labels: nonNilLabels(entry.Stream), Entries: make([]EntryOutput, 0, len(groups))}
+			for _, group := range groups {
+				output := newEntryOutput(group.ts, group.line)
+				if dedup != "" && dedup != DedupOff {
+					output.Count = group.count
+					output.FirstSeen = entryOutputTime(group.first)
+					output.LastSeen = entryOutputTime(group.last)
+				}
+				stream.Entries = append(stream.Entries, output)
+			}
+			output.Streams = append(output.Streams, stream)
+		}
+	}
+	return output
+}
+
+// newEntryOutput converts a [timestamp, line] pair, keeping the raw
+// timestamp if it is not a nanosecond Unix timestamp
+func newEntryOutput(ts, line string) EntryOutput {
+	return EntryOutput{Timestamp: entryOutputTime(ts), TimestampNs: ts, Line: line}
+}
+
+// entryOutputTime formats a nanosecond timestamp from Loki in UTC, or
+// returns it unchanged if it is not a number
+func entryOutputTime(ts string) string {
+	if ns, err := strconv.ParseInt(ts, 10, 64); err == nil {
+		return formatNanos(ns)
+	}
+	return ts
+}
+
+func newSampleOutput(sample LokiSample) SampleOutput {
+	return SampleOutput{Timestamp: sample.Time().UTC().Format(time.RFC3339Nano), Value: sample.Value}
+}
+
+// nonNilLabels makes an empty label set encode as {} rather than null
+func nonNilLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return map[string]string{}
+	}
+	return labels
+}
+
+// formatQueryOutput renders a query result in one of the machine-readable
+// or markdown formats. The label display options only apply to markdown,
+// since the other formats are meant for further processing.
+func formatQueryOutput(output QueryOutput, format string, opts formatOptions) (string, error) {
+	switch format {
+	case OutputFormatJSON:
+		data, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	case OutputFormatNDJSON:
+		return formatNDJSON(output)
+	case OutputFormatMarkdown:
+		return formatMarkdown(output, opts), nil
+	case OutputFormatCSV:
+		return formatCSV(output)
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+// formatNDJSON renders one JSON object per log line or metric sample
+func formatNDJSON(output QueryOutput) (string, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	for _, stream := range output.Streams {
+		for _, entry := range stream.Entries {
+			if err := enc.Encode(struct {
+				Labels map[string]string `json:"labels"`
+				EntryOutput
+			}{stream.Labels, entry}); err != nil {
+				return "", err
+			}
+		}
+	}
+	for _, series := range output.Series {
+		for _, sample := range series.Samples {
+			if err := enc.Encode(struct {
+				Labels map[string]string `json:"labels"`
+				SampleOutput
+			}{series.Labels, sample}); err != nil {
+				return "", err
+			}
+		}
+	}
+	if output.Scalar != nil {
+		if err := enc.Encode(output.Scalar); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// formatCSV renders one row per log line or metric sample, with the labels
+// as a stream selector
+func formatCSV(output QueryOutput) (string, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	switch {
+	case output.ResultType == ResultTypeScalar:
+		w.Write([]string{"timestamp", "value"})
+		if output.Scalar != nil {
+			w.Write([]string{output.Scalar.Timestamp, output.Scalar.Value})
+		}
+	case output.Series != nil:
+		w.Write([]string{"timestamp", "labels", "value"})
+		for _, series := range output.Series {
+			labels := formatSelector(series.Labels)
+			for _, sample := range series.Samples {
+				w.Write([]string{sample.Timestamp, labels, sample.Value})
+			}
+		}
+	case output.collapsed():
+		w.Write([]string{"timestamp", "timestamp_ns", "labels", "line", "count", "first_seen", "last_seen"})
+		for _, stream := range output.Streams {
+			labels := formatSelector(stream.Labels)
+			for _, entry := range stream.Entries {
+				w.Write([]string{entry.Timestamp, entry.TimestampNs, labels, entry.Line, strconv.Itoa(entry.Count), entry.FirstSeen, entry.LastSeen})
+			}
+		}
+	default:
+		w.Write([]string{"timestamp", "timestamp_ns", "labels", "line"})
+		for _, stream := range output.Streams {
+			labels := formatSelector(stream.Labels)
+			for _, entry := range stream.Entries {
+				w.Write([]string{entry.Timestamp, entry.TimestampNs, labels, entry.Line})
+			}
+		}
+	}
+
+	w.Flush()
+	return b.String(), w.Error()
+}
+
+// formatMarkdown renders a table per stream or series, followed by the notes
+func formatMarkdown(output QueryOutput, opts formatOptions) string {
+	var b strings.Builder
+
+	var sets []map[string]string
+	for _, stream := range output.Streams {
+		sets = append(sets, stream.Labels)
+	}
+	for _, series := range output.Series {
+		sets = append(sets, series.Labels)
+	}
+	headers, common := opts.labelHeaders(sets)
+
+	switch {
+	case output.ResultType == ResultTypeScalar:
+		if output.Scalar == nil {
+			b.WriteString("No data found matching the query\n")
+			break
+		}
+		b.WriteString("| Timestamp | Value |\n| --- | --- |\n")
+		fmt.Fprintf(&b, "| %s | %s |\n", output.Scalar.Timestamp, markdownCell(output.Scalar.Value))
+	case output.Series != nil:
+		if len(output.Series) == 0 {
+			b.WriteString("No series found matching the query\n")
+			break
+		}
+		fmt.Fprintf(&b, "Found %d series\n", len(output.Series))
+		writeMarkdownCommonLabels(&b, common)
+		for i, series := range output.Series {
+			fmt.Fprintf(&b, "\n### Series %d%s\n\n| Timestamp | Value |\n| --- | --- |\n", i+1, markdownLabels(headers[i]))
+			for _, sample := range series.Samples {
+				fmt.Fprintf(&b, "| %s | %s |\n", sample.Timestamp, markdownCell(sample.Value))
+			}
+		}
+	default:
+		if len(output.Streams) == 0 {
+			b.WriteString("No logs found matching the query\n")
+			break
+		}
+		fmt.Fprintf(&b, "Found %d streams\n", len(output.Streams))
+		writeMarkdownCommonLabels(&b, common)
+		collapsed := output.collapsed()
+		for i, stream := range output.Streams {
+			fmt.Fprintf(&b, "\n### Stream %d%s\n\n", i+1, markdownLabels(headers[i]))
+			if collapsed {
+				b.WriteString("| First seen | Last seen | Count | Line |\n| --- | --- | --- | --- |\n")
+			} else {
+				b.WriteString("| Timestamp | Line |\n| --- | --- |\n")
+			}
+			for _, entry := range stream.Entries {
+				if collapsed {
+					fmt.Fprintf(&b, "| %s | %s | %d | %s |\n", entry.FirstSeen, entry.LastSeen, entry.Count, markdownCell(entry.Line))
+				} else {
+					fmt.Fprintf(&b, "| %s | %s |\n", entry.Timestamp, markdownCell(entry.Line))
+				}
+			}
+		}
+	}
+
+	for _, note := range output.Notes {
+		fmt.Fprintf(&b, "\n%s\n", note)
+	}
+	return b.String()
+}
+
+// writeMarkdownCommonLabels writes the labels shared by all streams, if any
+func writeMarkdownCommonLabels(b *strings.Builder, common map[string]string) {
+	if len(common) > 0 {
+		fmt.Fprintf(b, "\nCommon labels: `%s`\n", formatSelector(common))
+	}
+}
+
+// markdownLabels formats the labels of a stream heading, if it has any
+func markdownLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" `%s`", formatSelector(labels))
+}
+
+// markdownCell escapes a value for a markdown table cell
+func markdownCell(value string) string {
+	value = strings.ReplaceAll(value, "\\", "\\\\")
+	value = strings.ReplaceAll(value, "|", "\\|")
+	value = strings.ReplaceAll(value, "\r\n", "<br>")
+	return strings.ReplaceAll(value, "\n", "<br>")
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// outputTestResult is a streams result with two streams
+var outputTestResult = &LokiResult{
+	Data: LokiData{
+		ResultType: ResultTypeStreams,
+		Result: []LokiEntry{
+			{Stream: map[string]string{"app": "api", "level": "error"}, Values: [][]string{
+				{"1705312245123456789", `failed | retrying "now"`},
+				{"1705312244000000000", "connection refused"},
+			}},
+			{Stream: map[string]string{"app": "web"}, Values: [][]string{{"1705312243000000000", "ok"}}},
+		},
+	},
+}
+
+// TestFormatQueryOutput_Streams tests each machine-readable format for a streams result
+func TestFormatQueryOutput_Streams(t *testing.T) {
+	output := newQueryOutput(outputTestResult, DedupOff)
+
+	ndjson, err := formatQueryOutput(output, OutputFormatNDJSON, formatOptions{})
+	if err != nil {
+		t.Fatalf("ndjson failed: %v", err)
+	}
+	expected := `{"labels":{"app":"api","level":"error"},"timestamp":"2024-01-15T09:50:45.123456789Z","timestamp_ns":"1705312245123456789","line":"failed | retrying \"now\""}` + "\n" +
+		`{"labels":{"app":"api","level":"error"},"timestamp":"2024-01-15T09:50:44Z","timestamp_ns":"1705312244000000000","line":"connection refused"}` + "\n" +
+		`{"labels":{"app":"web"},"timestamp":"2024-01-15T09:50:43Z","timestamp_ns":"1705312243000000000","line":"ok"}` + "\n"
+	if ndjson != expected {
+		t.Errorf("Expected ndjson:\n%s\ngot:\n%s", expected, ndjson)
+	}
+
+	csvOutput, err := formatQueryOutput(output, OutputFormatCSV, formatOptions{})
+	if err != nil {
+		t.Fatalf("csv failed: %v", err)
+	}
+	expected = "timestamp,timestamp_ns,labels,line\n" +
+		`2024-01-15T09:50:45.123456789Z,1705312245123456789,"{app=""api"", level=""error""}","failed | retrying ""now"""` + "\n" +
+		`2024-01-15T09:50:44Z,1705312244000000000,"{app=""api"", level=""error""}",connection refused` + "\n" +
+		`2024-01-15T09:50:43Z,1705312243000000000,"{app=""web""}",ok` + "\n"
+	if csvOutput != expected {
+		t.Errorf("Expected csv:\n%s\ngot:\n%s", expected, csvOutput)
+	}
+
+	markdown, err := formatQueryOutput(output, OutputFormatMarkdown, formatOptions{})
+	if err != nil {
+		t.Fatalf("markdown failed: %v", err)
+	}
+	if !strings.Contains(markdown, "### Stream 1 `{app=\"api\", level=\"error\"}`\n\n| Timestamp | Line |\n| --- | --- |\n") ||
+		!strings.Contains(markdown, "| 2024-01-15T09:50:45.123456789Z | failed \\| retrying \"now\" |\n") {
+		t.Errorf("Unexpected markdown:\n%s", markdown)
+	}
+
+	jsonOutput, err := formatQueryOutput(output, OutputFormatJSON, formatOptions{})
+	if err != nil {
+		t.Fatalf("json failed: %v", err)
+	}
+	var decoded QueryOutput
+	if err := json.Unmarshal([]byte(jsonOutput), &decoded); err != nil {
+		t.Fatalf("json output does not parse: %v", err)
+	}
+	if decoded.ResultType != ResultTypeStreams || len(decoded.Streams) != 2 || decoded.Streams[0].Entries[0].TimestampNs != "1705312245123456789" {
+		t.Errorf("Unexpected json output:\n%s", jsonOutput)
+	}
+}
+
+// TestFormatQueryOutput_Metrics tests the machine-readable formats for matrix and scalar results
+func TestFormatQueryOutput_Metrics(t *testing.T) {
+	matrix := newQueryOutput(&LokiResult{Data: LokiData{
+		ResultType: ResultTypeMatrix,
+		Metrics: []LokiMetric{
+			{Metric: map[string]string{"app": "api"}, Values: []LokiSample{{Timestamp: 1705312200, Value: "3"}, {Timestamp: 1705312260.5, Value: "4"}}},
+		},
+	}}, DedupOff)
+
+	csvOutput, err := formatQueryOutput(matrix, OutputFormatCSV, formatOptions{})
+	if err != nil {
+		t.Fatalf("csv failed: %v", err)
+	}
+	expected := "timestamp,labels,value\n" +
+		`2024-01-15T09:50:00Z,"{app=""api""}",3` + "\n" +
+		`2024-01-15T09:51:00.5Z,"{app=""api""}",4` + "\n"
+	if csvOutput != expected {
+		t.Errorf("Expected csv:\n%s\ngot:\n%s", expected, csvOutput)
+	}
+
+	scalar := newQueryOutput(&LokiResult{Data: LokiData{ResultType: ResultTypeScalar, Scalar: &LokiSample{Timestamp: 1705312200, Value: "42"}}}, DedupOff)
+	ndjson, err := formatQueryOutput(scalar, OutputFormatNDJSON, formatOptions{})
+	if err != nil {
+		t.Fatalf("ndjson failed: %v", err)
+	}
+	if ndjson != `{"timestamp":"2024-01-15T09:50:00Z","value":"42"}`+"\n" {
+		t.Errorf("Unexpected scalar ndjson: %s", ndjson)
+	}
+}
+
+// TestHandleLokiQuery_OutputFormat tests that ndjson sends the data once, followed by a summary with the notes
+func TestHandleLokiQuery_OutputFormat(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[
+			{"stream":{"app":"api"},"values":[["1705312245000000000","a"],["1705312244000000000","b"]]}
+		]}}`))
+	}))
+	defer server.Close()
+
+	result, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query":         `{app="api"}`,
+		"url":           server.URL,
+		"start":         "2024-01-15T09:00:00Z",
+		"end":           "2024-01-15T10:00:00Z",
+		"limit":         float64(2),
+		"output_format": "ndjson",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+
+	if len(result.Content) != 2 {
+		t.Fatalf("Expected data and summary content, got %d items", len(result.Content))
+	}
+	if lines := strings.Split(strings.TrimSpace(resultText(t, result)), "\n"); len(lines) != 2 {
+		t.Errorf("Expected 2 ndjson lines, got %q", lines)
+	}
+	summary, ok := mcp.AsTextContent(result.Content[1])
+	if !ok || !strings.HasPrefix(summary.Text, "Found 1 streams with 2 entries.\n\n") ||
+		!strings.Contains(summary.Text, "which is the limit") || !strings.Contains(summary.Text, "Time range: 2024-01-15T09:00:00Z") {
+		t.Errorf("Unexpected summary content: %+v", result.Content[1])
+	}
+
+	// The markdown result is a single text content ending with the notes
+	result, err = HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query":         `{app="api"}`,
+		"url":           server.URL,
+		"start":         "2024-01-15T09:00:00Z",
+		"end":           "2024-01-15T10:00:00Z",
+		"output_format": "markdown",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if len(result.Content) != 1 || strings.Count(resultText(t, result), "Time range: ") != 1 {
+		t.Errorf("Expected a single markdown content with the time range once, got %+v", result.Content)
+	}
+}
+
+// TestHandleLokiQuery_InvalidOutputFormat tests that an unknown output format is rejected
+func TestHandleLokiQuery_InvalidOutputFormat(t *testing.T) {
+	_, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query":         `{app="api"}`,
+		"output_format": "xml",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "invalid output_format") {
+		t.Errorf("Expected output_format error, got %v", err)
+	}
+}
+
+// TestHandleLokiQuery_OutputFormatJSON tests that the json format sends the data once, as the resource, with a text summary
+func TestHandleLokiQuery_OutputFormatJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[
+			{"stream":{"app":"api"},"values":[["1705312245000000000","unique-line-a"],["1705312244000000000","unique-line-b"]]}
+		]}}`))
+	}))
+	defer server.Close()
+
+	result, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query":         `{app="api"}`,
+		"url":           server.URL,
+		"start":         "2024-01-15T09:00:00Z",
+		"end":           "2024-01-15T10:00:00Z",
+		"output_format": "json",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+
+	if len(result.Content) != 2 {
+		t.Fatalf("Expected a summary and a resource, got %d items", len(result.Content))
+	}
+	summary := resultText(t, result)
+	if !strings.HasPrefix(summary, "Found 1 streams with 2 entries. The result is attached as JSON in the loki://query/result resource.") ||
+		!strings.Contains(summary, "Time range: 2024-01-15T09:00:00Z") {
+		t.Errorf("Unexpected summary: %q", summary)
+	}
+	if strings.Contains(summary, "unique-line-a") {
+		t.Errorf("Expected the log lines only in the resource, got %q", summary)
+	}
+
+	resource, ok := mcp.AsEmbeddedResource(result.Content[1])
+	if !ok {
+		t.Fatalf("Expected an embedded resource, got %T", result.Content[1])
+	}
+	contents := resource.Resource.(mcp.TextResourceContents)
+	if !strings.Contains(contents.Text, "unique-line-a") || !strings.Contains(contents.Text, "unique-line-b") {
+		t.Errorf("Expected the log lines in the resource, got %s", contents.Text)
+	}
+}
+
+// TestHandleLokiQuery_OutputFormatBudget tests that the output budget limits the whole result of formats other than text
+func TestHandleLokiQuery_OutputFormatBudget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var values []string
+		for i := 0; i < 2000; i++ {
+			values = append(values, fmt.Sprintf(`["%d","request %d: %s"]`, int64(1705312800+i)*1000000000, i, strings.Repeat("x", 200)))
+		}
+		fmt.Fprintf(w, `{"status":"success","data":{"resultType":"streams","result":[
+			{"stream":{"app":"api"},"values":[%s]}
+		]}}`, strings.Join(values, ","))
+	}))
+	defer server.Close()
+
+	for _, format := range []string{OutputFormatJSON, OutputFormatMarkdown, OutputFormatNDJSON, OutputFormatCSV} {
+		result, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+			"query":            `{app="api"}`,
+			"url":              server.URL,
+			"start":            "2024-01-15T10:00:00Z",
+			"end":              "2024-01-15T11:00:00Z",
+			"limit":            float64(5000),
+			"output_format":    format,
+			"max_output_bytes": float64(10000),
+			"max_line_bytes":   float64(100),
+		}))
+		if err != nil {
+			t.Fatalf("HandleLokiQuery failed for %s: %v", format, err)
+		}
+
+		all := contentText(result)
+		if len(all) > 10000 {
+			t.Errorf("Expected the %s result within 10000 bytes in total, got %d", format, len(all))
+		}
+		if !strings.Contains(all, "request 0: "+strings.Repeat("x", 89)+"… [111 more bytes]") || !strings.Contains(all, "request 1999: ") ||
+			strings.Contains(all, "request 1000: ") {
+			t.Errorf("Expected the first and last %s entries, shortened, got:\n%s", format, all)
+		}
+		if !strings.Contains(all, "Output limited to 10000 bytes: ") || !strings.Contains(all, " of 2000 entries kept, the middle ") ||
+			!strings.Contains(all, "2000 lines longer than 100 bytes shortened") {
+			t.Errorf("Expected a budget note for %s, got:\n%s", format, all)
+		}
+	}
+}
+
+// contentText joins the text of every text content and embedded resource of a result
+func contentText(result *mcp.CallToolResult) string {
+	var b strings.Builder
+	for _, content := range result.Content {
+		if text, ok := mcp.AsTextContent(content); ok {
+			b.WriteString(text.Text)
+		} else if resource, ok := mcp.AsEmbeddedResource(content); ok {
+			b.WriteString(resource.Resource.(mcp.TextResourceContents).Text)
+		}
+	}
+	return b.String()
+}
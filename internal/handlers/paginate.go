@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Budgets for paginated loki_query calls
+const (
+	DefaultPaginateMaxLines = 1000
+	MaxPaginateMaxLines     = 50000
+	DefaultPaginateMaxBytes = 1000000
+	MaxPaginateMaxBytes     = 10000000
+)
+
+// paginationBudget bounds the total lines and bytes fetched across all pages
+type paginationBudget struct {
+	maxLines int
+	maxBytes int
+}
+
+// paginationBudgetFromRequest extracts the max_total_lines and
+// max_total_bytes arguments, capped at their maximums
+func paginationBudgetFromRequest(args map[string]any) paginationBudget {
+	budget := paginationBudget{maxLines: DefaultPaginateMaxLines, maxBytes: DefaultPaginateMaxBytes}
+	if linesVal, ok := args["max_total_lines"].(float64); ok && linesVal > 0 {
+		budget.maxLines = min(int(linesVal), MaxPaginateMaxLines)
+	}
+	if bytesVal, ok := args["max_total_bytes"].(float64); ok && bytesVal > 0 {
+		budget.maxBytes = min(int(bytesVal), MaxPaginateMaxBytes)
+	}
+	return budget
+}
+
+// paginationReport describes what a paginated query fetched
+type paginationReport struct {
+	direction string
+	// start and end are the requested range in nanoseconds
+	start, end int64
+	pages      int
+	lines      int
+	bytes      int
+	// truncated is set when the budget ran out before the range was covered,
+	// and last is then the timestamp of the last entry kept
+	truncated bool
+	reason    string
+	last      int64
+}
+
+// pageEntry is a log entry of a page along with its stream
+type pageEntry struct {
+	stream map[string]string
+	key    string
+	ts     int64
+	value  []string
+}
+
+// paginateLokiQuery runs a log query page by page, moving the range past the
+// last returned timestamp in the query direction, until the range is covered
+// or the budget runs out. start and end are in nanoseconds. Metric queries
+// are returned after the first page without a report.
+func paginateLokiQuery(ctx context.Context, conn lokiConnection, query string, start, end int64, pageSize int, opts queryRangeOptions, budget paginationBudget) (*LokiResult, *paginationReport, error) {
+	direction := opts.Direction
+	report := &paginationReport{direction: direction, start: start, end: end}
+	merged := &LokiResult{Status: "success", Data: LokiData{ResultType: ResultTypeStreams}}
+	streamIndex := make(map[string]int)
+
+	// Entries sharing the last timestamp are returned again by the next page
+	pageStart, pageEnd := start, end
+	boundary := make(map[string]bool)
+
+	// fetch grows when a whole page is taken up by entries already seen
+	fetch := 0
+	for {
+		size := min(pageSize, budget.maxLines-report.lines)
+		fetch = max(fetch, size)
+
+		pageURL, err := buildLokiQueryURL(conn.URL, query, pageStart, pageEnd, fetch, opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to build query URL: %v", err)
+		}
+
+		page, err := executeLokiQuery(ctx, pageURL, conn)
+		if err != nil {
+			return nil, nil, err
+		}
+		if page.Data.ResultType != ResultTypeStreams {
+			if report.pages == 0 {
+				return page, nil, nil
+			}
+			return nil, nil, fmt.Errorf("unexpected %s result while paginating", page.Data.ResultType)
+		}
+		report.pages++
+
+		entries := sortedPageEntries(page.Data.Result, direction)
+		added := 0
+		for _, entry := range entries {
+			entryKey := entry.key + "\x00" + entry.value[0] + "\x00" + entry.value[1]
+			if boundary[entryKey] {
+				continue
+			}
+			if report.lines >= budget.maxLines {
+				report.truncated = true
+				report.reason = fmt.Sprintf("the %d line budget", budget.maxLines)
+				break
+			}
+			if report.bytes+len(entry.value[1]) > budget.maxBytes {
+				report.truncated = true
+				report.reason = fmt.Sprintf("the %s byte budget", formatBytes(uint64(budget.maxBytes)))
+				break
+			}
+
+			i, ok := streamIndex[entry.key]
+			if !ok {
+				i = len(merged.Data.Result)
+				streamIndex[entry.key] = i
+				merged.Data.Result = append(merged.Data.Result, LokiEntry{Stream: entry.stream})
+			}
+			merged.Data.Result[i].Values = append(merged.Data.Result[i].Values, entry.value)
+
+			if entry.ts != report.last {
+				boundary = make(map[string]bool)
+			}
+			boundary[entryKey] = true
+			report.last = entry.ts
+			report.lines++
+			report.bytes += len(entry.value[1])
+			added++
+		}
+
+		switch {
+		case report.truncated:
+			return merged, report, nil
+		case len(entries) < fetch:
+			// Loki returned less than a full page, so the range is covered
+			return merged, report, nil
+		case report.lines >= budget.maxLines:
+			report.truncated = true
+			report.reason = fmt.Sprintf("the %d line budget", budget.maxLines)
+			return merged, report, nil
+		case added == 0:
+			// At least a page of entries share the last timestamp, so ask
+			// for a bigger page to get past them
+			if fetch >= MaxPaginateMaxLines {
+				report.truncated = true
+				report.reason = "too many entries sharing one timestamp"
+				return merged, report, nil
+			}
+			fetch = min(fetch*2, MaxPaginateMaxLines)
+			continue
+		}
+		fetch = 0
+
+		// Continue from the last timestamp, which is included again so that
+		// entries sharing it are not lost
+		if direction == DirectionForward {
+			pageStart = report.last
+		} else {
+			pageEnd = report.last + 1
+		}
+	}
+}
+
+// sortedPageEntries flattens the streams of a page into entries ordered by
+// timestamp in the query direction
+func sortedPageEntries(streams []LokiEntry, direction string) []pageEntry {
+	var entries []pageEntry
+	for _, stream := range streams {
+		key := formatSelector(stream.Stream)
+		for _, value := range stream.Values {
+			if len(value) < 2 {
+				continue
+			}
+			ts, err := strconv.ParseInt(value[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, pageEntry{stream: stream.Stream, key: key, ts: ts, value: value})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if direction == DirectionForward {
+			return entries[i].ts < entries[j].ts
+		}
+		return entries[i].ts > entries[j].ts
+	})
+	return entries
+}
+
+// format describes the pages fetched and the time range they cover, with
+// times in loc
+func (r *paginationReport) format(loc *time.Location) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Pagination: fetched %d lines (%s) in %d pages", r.lines, formatBytes(uint64(r.bytes)), r.pages)
+
+	coveredStart, coveredEnd := r.start, r.end
+	if r.truncated {
+		fmt.Fprintf(&b, "; truncated at %s, more lines may exist", r.reason)
+		if r.lines > 0 {
+			if r.direction == DirectionForward {
+				coveredEnd = r.last
+			} else {
+				coveredStart = r.last
+			}
+		}
+	}
+	fmt.Fprintf(&b, "\nCovered range: %s to %s", formatNanosIn(coveredStart, loc), formatNanosIn(coveredEnd, loc))
+	if r.truncated {
+		fmt.Fprintf(&b, " (requested %s to %s)", formatNanosIn(r.start, loc), formatNanosIn(r.end, loc))
+	}
+	return b.String()
+}
+
+// formatNanos formats a Unix timestamp in nanoseconds as RFC3339 in UTC
+func formatNanos(ns int64) string {
+	return formatNanosIn(ns, time.UTC)
+}
+
+// formatNanosIn formats a Unix timestamp in nanoseconds as RFC3339 in loc
+func formatNanosIn(ns int64, loc *time.Location) string {
+	return time.Unix(0, ns).In(loc).Format(time.RFC3339Nano)
+}
+
+// runPaginatedLokiQuery runs a paginated loki_query and formats the merged
+// result along with the pagination report
+func runPaginatedLokiQuery(ctx context.Context, conn lokiConnection, queryString string, start, end int64, pageSize int, opts queryRangeOptions, budget paginationBudget, formatting formatOptions) (*mcp.CallToolResult, error) {
+	result, report, err := paginateLokiQuery(ctx, conn, queryString, start, end, pageSize, opts, budget)
+	if err != nil {
+		return nil, fmt.Errorf("query execution failed: %v", err)
+	}
+
+	// Broadcast results to SSE clients if available
+	broadcastQueryResults(ctx, queryString, result)
+
+	var notes []string
+	if report != nil {
+		notes = append(notes, report.format(formatting.location()))
+	}
+	return conn.queryToolResult(result, formatting, notes)
+}
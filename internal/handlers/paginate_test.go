@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeLogEntry is a log line served by newPagingLokiServer
+type fakeLogEntry struct {
+	app  string
+	ts   int64
+	line string
+}
+
+// newPagingLokiServer serves query_range over a fixed set of entries, honoring start, end, limit and direction
+func newPagingLokiServer(t *testing.T, entries []fakeLogEntry, pages *int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*pages++
+		q := r.URL.Query()
+		start, end := parseFakeTimestamp(q.Get("start")), parseFakeTimestamp(q.Get("end"))
+		limit, _ := strconv.Atoi(q.Get("limit"))
+
+		var matched []fakeLogEntry
+		for _, entry := range entries {
+			if entry.ts >= start && entry.ts < end {
+				matched = append(matched, entry)
+			}
+		}
+		sort.SliceStable(matched, func(i, j int) bool {
+			if q.Get("direction") == DirectionForward {
+				return matched[i].ts < matched[j].ts
+			}
+			return matched[i].ts > matched[j].ts
+		})
+		if len(matched) > limit {
+			matched = matched[:limit]
+		}
+
+		streams := map[string][][]string{}
+		for _, entry := range matched {
+			streams[entry.app] = append(streams[entry.app], []string{strconv.FormatInt(entry.ts, 10), entry.line})
+		}
+		var result []map[string]any
+		for app, values := range streams {
+			result = append(result, map[string]any{"stream": map[string]string{"app": app}, "values": values})
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"status": "success",
+			"data":   map[string]any{"resultType": "streams", "result": result},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// parseFakeTimestamp parses a Unix timestamp in seconds or nanoseconds, like Loki does
+func parseFakeTimestamp(value string) int64 {
+	ts, _ := strconv.ParseInt(value, 10, 64)
+	if len(value) <= 10 {
+		return ts * int64(time.Second)
+	}
+	return ts
+}
+
+// pagingTestEntries returns five entries, two of which share a timestamp across streams
+func pagingTestEntries() []fakeLogEntry {
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC).UnixNano()
+	return []fakeLogEntry{
+		{"api", base + 1, "line 1"},
+		{"api", base + 2, "line 2"},
+		{"api", base + 3, "line 3"},
+		{"web", base + 3, "line 3 web"},
+		{"web", base + 4, "line 4"},
+	}
+}
+
+// TestHandleLokiQuery_Paginate tests that pages are walked backward without losing or repeating entries that share a timestamp,
+// including pages taken up entirely by entries already seen
+func TestHandleLokiQuery_Paginate(t *testing.T) {
+	var pages int
+	server := newPagingLokiServer(t, pagingTestEntries(), &pages)
+
+	result, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query":    `{app=~".+"}`,
+		"url":      server.URL,
+		"start":    "2024-01-15T10:00:00Z",
+		"end":      "2024-01-15T11:00:00Z",
+		"limit":    float64(2),
+		"paginate": true,
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	text := resultText(t, result)
+
+	for _, line := range []string{"line 1", "line 2", "line 3\n", "line 3 web", "line 4"} {
+		if strings.Count(text, line) != 1 {
+			t.Errorf("Expected %q exactly once in:\n%s", line, text)
+		}
+	}
+	if !strings.Contains(text, "Pagination: fetched 5 lines (34B) in 5 pages\nCovered range: 2024-01-15T10:00:00Z to 2024-01-15T11:00:00Z") {
+		t.Errorf("Unexpected pagination report in:\n%s", text)
+	}
+	if pages != 5 {
+		t.Errorf("Expected 5 pages, got %d", pages)
+	}
+}
+
+// TestHandleLokiQuery_PaginateBudget tests that the line budget truncates the result and reports the covered range
+func TestHandleLokiQuery_PaginateBudget(t *testing.T) {
+	var pages int
+	server := newPagingLokiServer(t, pagingTestEntries(), &pages)
+
+	result, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query":           `{app=~".+"}`,
+		"url":             server.URL,
+		"start":           "2024-01-15T10:00:00Z",
+		"end":             "2024-01-15T11:00:00Z",
+		"limit":           float64(2),
+		"paginate":        true,
+		"max_total_lines": float64(3),
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	text := resultText(t, result)
+
+	if strings.Contains(text, "line 2") || strings.Contains(text, "line 1") {
+		t.Errorf("Expected only the newest 3 lines in:\n%s", text)
+	}
+	expected := "Pagination: fetched 3 lines (22B) in 3 pages; truncated at the 3 line budget, more lines may exist\n" +
+		"Covered range: 2024-01-15T10:00:00.000000003Z to 2024-01-15T11:00:00Z (requested 2024-01-15T10:00:00Z to 2024-01-15T11:00:00Z)"
+	if !strings.Contains(text, expected) {
+		t.Errorf("Expected report:\n%s\nGot:\n%s", expected, text)
+	}
+}
+
+// TestHandleLokiQuery_LimitReached tests that a result cut at the limit is reported when not paginating
+func TestHandleLokiQuery_LimitReached(t *testing.T) {
+	var pages int
+	server := newPagingLokiServer(t, pagingTestEntries(), &pages)
+
+	args := map[string]any{
+		"query": `{app=~".+"}`,
+		"url":   server.URL,
+		"start": "2024-01-15T10:00:00Z",
+		"end":   "2024-01-15T11:00:00Z",
+		"limit": float64(2),
+	}
+	result, err := HandleLokiQuery(context.Background(), newCallToolRequest(args))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if text := resultText(t, result); !strings.Contains(text, "Note: 2 lines returned, which is the limit") {
+		t.Errorf("Expected a truncation note in:\n%s", text)
+	}
+
+	args["limit"] = float64(10)
+	result, err = HandleLokiQuery(context.Background(), newCallToolRequest(args))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if text := resultText(t, result); strings.Contains(text, "Note:") {
+		t.Errorf("Expected no truncation note in:\n%s", text)
+	}
+}
+
+// TestHandleLokiQuery_InvalidLimit tests that a limit below one line is rejected before anything is sent to Loki
+func TestHandleLokiQuery_InvalidLimit(t *testing.T) {
+	var pages int
+	server := newPagingLokiServer(t, pagingTestEntries(), &pages)
+
+	for _, limit := range []float64{0, -5, 0.5} {
+		for _, paginate := range []bool{false, true} {
+			_, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+				"query":    `{app=~".+"}`,
+				"url":      server.URL,
+				"limit":    limit,
+				"paginate": paginate,
+			}))
+			if err == nil || !strings.Contains(err.Error(), "invalid limit") {
+				t.Errorf("limit %v, paginate %v: expected an invalid limit error, got %v", limit, paginate, err)
+			}
+		}
+	}
+	if _, err := HandleLokiInstantQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app=~".+"}`, "url": server.URL, "limit": float64(0)})); err == nil {
+		t.Error("Expected an invalid limit error for an instant query")
+	}
+	if pages != 0 {
+		t.Errorf("Expected no request to Loki, got %d", pages)
+	}
+}
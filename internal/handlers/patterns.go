@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// DefaultPatternsLimit is the default maximum number of patterns returned by loki_patterns
+const DefaultPatternsLimit = 50
+
+// LokiPatternsResult represents the response of the Loki patterns endpoint
+type LokiPatternsResult struct {
+	Status string        `json:"status"`
+	Data   []LokiPattern `json:"data"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// LokiPattern represents a detected log pattern and its samples over time
+type LokiPattern struct {
+	Pattern string      `json:"pattern"`
+	Level   string      `json:"level,omitempty"`
+	Samples [][]float64 `json:"samples"` // [timestamp, count]
+}
+
+// NewLokiPatternsTool creates and returns a tool for listing detected log patterns
+func NewLokiPatternsTool() mcp.Tool {
+	options := []mcp.ToolOption{
+		mcp.WithDescription("List the log patterns Grafana Loki detected for a stream selector, sorted by how often they occur. Use this to summarize a noisy service without reading every line (requires Loki 3.x with pattern ingestion enabled)"),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("LogQL stream selector, e.g. {app=\"api\"}"),
+		),
+	}
+	options = append(options, lokiConnectionOptions()...)
+	options = append(options,
+		mcp.WithString("start",
+			mcp.Description("Start time for the lookup (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the lookup (default: now)"),
+		),
+		mcp.WithString("step",
+			mcp.Description("Resolution of the pattern samples as a duration, e.g. 1m (default: chosen by Loki)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum number of patterns to return (default: %d)", DefaultPatternsLimit)),
+		),
+	)
+
+	return mcp.NewTool("loki_patterns", options...)
+}
+
+// HandleLokiPatterns handles Loki patterns tool requests
+func HandleLokiPatterns(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.Params.Arguments
+	query, ok := args["query"].(string)
+	if !ok || query == "" {
+		return nil, fmt.Errorf("query parameter is required")
+	}
+	conn, err := lokiConnectionFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, err := conn.timeRangeFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := DefaultPatternsLimit
+	if limitVal, ok := args["limit"].(float64); ok && limitVal > 0 {
+		limit = int(limitVal)
+	}
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", strconv.FormatInt(start, 10))
+	params.Set("end", strconv.FormatInt(end, 10))
+	if step, ok := args["step"].(string); ok && step != "" {
+		params.Set("step", step)
+	}
+
+	patternsURL, err := buildLokiURL(conn.URL, "patterns", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query URL: %v", err)
+	}
+
+	var result LokiPatternsResult
+	if err := executeLokiRequest(ctx, patternsURL, conn, &result); err != nil {
+		return nil, fmt.Errorf("patterns query failed: %v", err)
+	}
+
+	// Check for Loki errors
+	if result.Status == "error" {
+		return nil, fmt.Errorf("patterns query failed: loki error: %s", result.Error)
+	}
+
+	return conn.toolResultText(formatPatterns(result.Data, limit)), nil
+}
+
+// formatPatterns formats detected patterns with their total sample counts,
+// most frequent first, returning at most limit patterns
+func formatPatterns(patterns []LokiPattern, limit int) string {
+	if len(patterns) == 0 {
+		return "No patterns found matching the query"
+	}
+
+	type patternCount struct {
+		pattern LokiPattern
+		count   int64
+	}
+	counts := make([]patternCount, 0, len(patterns))
+	var total int64
+	for _, pattern := range patterns {
+		var count int64
+		for _, sample := range pattern.Samples {
+			if len(sample) >= 2 {
+				count += int64(sample[1])
+			}
+		}
+		counts = append(counts, patternCount{pattern: pattern, count: count})
+		total += count
+	}
+	sort.SliceStable(counts, func(i, j int) bool {
+		return counts[i].count > counts[j].count
+	})
+
+	var b strings.Builder
+	if len(counts) > limit {
+		fmt.Fprintf(&b, "Found %d patterns across %d lines (showing top %d):\n\n", len(counts), total, limit)
+		counts = counts[:limit]
+	} else {
+		fmt.Fprintf(&b, "Found %d patterns across %d lines:\n\n", len(counts), total)
+	}
+	for _, c := range counts {
+		share := 0.0
+		if total > 0 {
+			share = float64(c.count) / float64(total) * 100
+		}
+		level := ""
+		if c.pattern.Level != "" {
+			level = fmt.Sprintf(" [%s]", c.pattern.Level)
+		}
+		fmt.Fprintf(&b, "%d (%.1f%%)%s %s\n", c.count, share, level, c.pattern.Pattern)
+	}
+	return b.String()
+}
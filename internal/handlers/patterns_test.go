@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestHandleLokiPatterns tests that patterns are fetched and sorted by total sample count
+func TestHandleLokiPatterns(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/patterns" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("query") != `{app="api"}` || q.Get("step") != "1m" {
+			t.Errorf("Unexpected parameters: %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"status":"success","data":[
+			{"pattern":"<_> level=info msg=\"request served\" <_>","level":"info","samples":[[1705312245,10],[1705312305,20]]},
+			{"pattern":"<_> level=error msg=\"connection refused\" <_>","level":"error","samples":[[1705312245,70]]}
+		]}`))
+	}))
+	defer server.Close()
+
+	result, err := HandleLokiPatterns(context.Background(), newCallToolRequest(map[string]any{
+		"url":   server.URL,
+		"query": `{app="api"}`,
+		"step":  "1m",
+		"start": "2024-01-15T10:00:00Z",
+		"end":   "2024-01-15T11:00:00Z",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiPatterns failed: %v", err)
+	}
+
+	expected := "Found 2 patterns across 100 lines:\n\n" +
+		"70 (70.0%) [error] <_> level=error msg=\"connection refused\" <_>\n" +
+		"30 (30.0%) [info] <_> level=info msg=\"request served\" <_>\n\n" +
+		"Time range: 2024-01-15T10:00:00Z to 2024-01-15T11:00:00Z (1h)"
+	if output := resultText(t, result); output != expected {
+		t.Errorf("Expected %q, got %q", expected, output)
+	}
+}
+
+// TestFormatPatterns_Limit tests that only the most frequent patterns are returned
+func TestFormatPatterns_Limit(t *testing.T) {
+	patterns := []LokiPattern{
+		{Pattern: "rare", Samples: [][]float64{{1705312245, 1}}},
+		{Pattern: "common", Samples: [][]float64{{1705312245, 5}}},
+		{Pattern: "medium", Samples: [][]float64{{1705312245, 3}}},
+	}
+
+	output := formatPatterns(patterns, 2)
+	if !strings.HasPrefix(output, "Found 3 patterns across 9 lines (showing top 2):") {
+		t.Errorf("Unexpected header:\n%s", output)
+	}
+	if !strings.Contains(output, "common") || !strings.Contains(output, "medium") || strings.Contains(output, "rare") {
+		t.Errorf("Expected only the top 2 patterns, got:\n%s", output)
+	}
+}
+
+// TestFormatPatterns_Empty tests the message when no patterns are detected
+func TestFormatPatterns_Empty(t *testing.T) {
+	if output := formatPatterns(nil, 10); output != "No patterns found matching the query" {
+		t.Errorf("Unexpected output: %q", output)
+	}
+}
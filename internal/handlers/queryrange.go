@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// MaxQueryPoints is the maximum number of points per series Loki returns
+// for a range query; a smaller step is rejected by Loki
+const MaxQueryPoints = 11000
+
+// Number of points per series aimed for by the default step
+const defaultQueryPoints = 250
+
+// Steps the default step is rounded up to, so series line up with wall
+// clock boundaries
+var defaultQuerySteps = []time.Duration{
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 15 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// queryRangeOptions holds the optional parameters of a range query
+type queryRangeOptions struct {
+	Direction string
+	// Step is the resolution of metric queries, and Interval returns only
+	// one log line per interval for log queries
+	Step     time.Duration
+	Interval time.Duration
+}
+
+// queryRangeOptionsFromRequest extracts and validates the direction, step and
+// interval arguments. The step defaults to a value giving about 250 points
+// over the range.
+func queryRangeOptionsFromRequest(args map[string]any, rangeLength time.Duration) (queryRangeOptions, error) {
+	direction, err := directionFromRequest(args)
+	if err != nil {
+		return queryRangeOptions{}, err
+	}
+	opts := queryRangeOptions{
+		Direction: direction,
+		Step:      defaultQueryStep(rangeLength),
+	}
+
+	if stepArg, ok := args["step"]; ok {
+		step, err := parseStep(stepArg)
+		if err != nil {
+			return queryRangeOptions{}, fmt.Errorf("invalid step: %v", err)
+		}
+		if step > 0 {
+			opts.Step = step
+		}
+	}
+	if points := int64(rangeLength / opts.Step); points > MaxQueryPoints {
+		return queryRangeOptions{}, fmt.Errorf("step %s is too small for the time range: %d points exceed the maximum of %d, use a larger step", opts.Step, points, MaxQueryPoints)
+	}
+
+	if intervalArg, ok := args["interval"]; ok {
+		interval, err := parseStep(intervalArg)
+		if err != nil {
+			return queryRangeOptions{}, fmt.Errorf("invalid interval: %v", err)
+		}
+		opts.Interval = interval
+	}
+
+	return opts, nil
+}
+
+// directionFromRequest extracts the direction argument, defaulting to backward
+func directionFromRequest(args map[string]any) (string, error) {
+	directionStr, ok := args["direction"].(string)
+	if !ok || directionStr == "" {
+		return DirectionBackward, nil
+	}
+	if directionStr != DirectionBackward && directionStr != DirectionForward {
+		return "", fmt.Errorf("invalid direction: %s (must be %s or %s)", directionStr, DirectionBackward, DirectionForward)
+	}
+	return directionStr, nil
+}
+
+// parseStep parses a step or interval given as a duration such as 30s, or as
+// a number of seconds. An empty string returns zero.
+func parseStep(value any) (time.Duration, error) {
+	var step time.Duration
+	switch v := value.(type) {
+	case float64:
+		step = time.Duration(v * float64(time.Second))
+	case string:
+		if v == "" {
+			return 0, nil
+		}
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+			step = time.Duration(seconds * float64(time.Second))
+		} else if step, err = time.ParseDuration(v); err != nil {
+			return 0, fmt.Errorf("%q is not a duration", v)
+		}
+	default:
+		return 0, fmt.Errorf("expected a duration, got %T", value)
+	}
+
+	if step <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return step, nil
+}
+
+// defaultQueryStep returns the smallest round step giving at most about 250
+// points over the range, and at least one second
+func defaultQueryStep(rangeLength time.Duration) time.Duration {
+	target := rangeLength / defaultQueryPoints
+	for _, step := range defaultQuerySteps {
+		if step >= target {
+			return step
+		}
+	}
+	return target.Round(time.Hour)
+}
+
+// set adds the options to the parameters of a range query
+func (o queryRangeOptions) set(params url.Values) {
+	if o.Direction != "" {
+		params.Set("direction", o.Direction)
+	}
+	if o.Step > 0 {
+		params.Set("step", formatSeconds(o.Step))
+	}
+	if o.Interval > 0 {
+		params.Set("interval", formatSeconds(o.Interval))
+	}
+}
+
+// formatSeconds formats a duration as a number of seconds, as accepted by
+// the Loki API
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
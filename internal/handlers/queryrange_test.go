@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestQueryRangeOptionsFromRequest tests the direction, step and interval arguments and the default step
+func TestQueryRangeOptionsFromRequest(t *testing.T) {
+	testCases := []struct {
+		name        string
+		args        map[string]any
+		rangeLength time.Duration
+		expected    queryRangeOptions
+	}{
+		{"defaults for 1h", map[string]any{}, time.Hour, queryRangeOptions{Direction: DirectionBackward, Step: 15 * time.Second}},
+		{"defaults for 24h", map[string]any{}, 24 * time.Hour, queryRangeOptions{Direction: DirectionBackward, Step: 10 * time.Minute}},
+		{"defaults for 7d", map[string]any{}, 7 * 24 * time.Hour, queryRangeOptions{Direction: DirectionBackward, Step: time.Hour}},
+		{"short range", map[string]any{}, time.Minute, queryRangeOptions{Direction: DirectionBackward, Step: time.Second}},
+		{"duration step", map[string]any{"step": "1m", "direction": "forward"}, time.Hour, queryRangeOptions{Direction: DirectionForward, Step: time.Minute}},
+		{"seconds step", map[string]any{"step": "30"}, time.Hour, queryRangeOptions{Direction: DirectionBackward, Step: 30 * time.Second}},
+		{"numeric step", map[string]any{"step": float64(5)}, time.Hour, queryRangeOptions{Direction: DirectionBackward, Step: 5 * time.Second}},
+		{"interval", map[string]any{"interval": "30s"}, time.Hour, queryRangeOptions{Direction: DirectionBackward, Step: 15 * time.Second, Interval: 30 * time.Second}},
+	}
+
+	for _, tc := range testCases {
+		opts, err := queryRangeOptionsFromRequest(tc.args, tc.rangeLength)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if opts != tc.expected {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.expected, opts)
+		}
+	}
+}
+
+// TestQueryRangeOptionsFromRequest_Invalid tests that invalid arguments are rejected before querying Loki
+func TestQueryRangeOptionsFromRequest_Invalid(t *testing.T) {
+	testCases := map[string]map[string]any{
+		"invalid direction":  {"direction": "sideways"},
+		"invalid step":       {"step": "often"},
+		"must be positive":   {"step": "-1m"},
+		"exceed the maximum": {"step": "100ms"},
+		"invalid interval":   {"interval": "0s"},
+	}
+
+	for expected, args := range testCases {
+		if _, err := queryRangeOptionsFromRequest(args, time.Hour); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error containing %q, got %v", expected, err)
+		}
+	}
+}
+
+// TestHandleLokiQuery_RangeParameters tests that direction, step and interval are sent to Loki
+func TestHandleLokiQuery_RangeParameters(t *testing.T) {
+	var last *http.Request
+	server := recordingLokiServer(t, &last)
+
+	_, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query":     `{app="api"}`,
+		"url":       server.URL,
+		"start":     "2024-01-15T10:00:00Z",
+		"end":       "2024-01-15T16:00:00Z",
+		"direction": "forward",
+		"interval":  "30s",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+
+	q := last.URL.Query()
+	// 6h / 250 points = 86.4s, rounded up to 2m
+	if q.Get("direction") != "forward" || q.Get("step") != "120" || q.Get("interval") != "30" {
+		t.Errorf("Unexpected query parameters: %s", last.URL.RawQuery)
+	}
+}
+
+// TestHandleLokiQuery_PaginateForward tests that forward pagination returns the oldest lines first and reports the covered range
+func TestHandleLokiQuery_PaginateForward(t *testing.T) {
+	var pages int
+	server := newPagingLokiServer(t, pagingTestEntries(), &pages)
+
+	result, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query":           `{app=~".+"}`,
+		"url":             server.URL,
+		"start":           "2024-01-15T10:00:00Z",
+		"end":             "2024-01-15T11:00:00Z",
+		"limit":           float64(2),
+		"direction":       "forward",
+		"paginate":        true,
+		"max_total_lines": float64(2),
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	text := resultText(t, result)
+
+	if !strings.Contains(text, "line 1\n") || !strings.Contains(text, "line 2\n") || strings.Contains(text, "line 3") {
+		t.Errorf("Expected the oldest 2 lines in:\n%s", text)
+	}
+	if !strings.Contains(text, "Covered range: 2024-01-15T10:00:00Z to 2024-01-15T10:00:00.000000002Z") {
+		t.Errorf("Unexpected covered range in:\n%s", text)
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
+)
+
+// Defaults of the retry policy for transient Loki failures
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff     = 10 * time.Second
+)
+
+// retryPolicy decides how often and how long to wait before retrying a
+// request. It is only applied to the GET requests of the Loki read API,
+// which are idempotent.
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// retryPolicyFor fills in the defaults for unset retry settings
+func retryPolicyFor(cfg config.RetryConfig) retryPolicy {
+	policy := retryPolicy{
+		maxAttempts:    defaultRetryMaxAttempts,
+		initialBackoff: defaultRetryInitialBackoff,
+		maxBackoff:     defaultRetryMaxBackoff,
+	}
+	if cfg.MaxAttempts > 0 {
+		policy.maxAttempts = cfg.MaxAttempts
+	}
+	if cfg.InitialBackoff > 0 {
+		policy.initialBackoff = cfg.InitialBackoff
+	}
+	if cfg.MaxBackoff > 0 {
+		policy.maxBackoff = cfg.MaxBackoff
+	}
+	if policy.initialBackoff > policy.maxBackoff {
+		policy.initialBackoff = policy.maxBackoff
+	}
+	return policy
+}
+
+// backoff returns the delay after the given failed attempt: the initial
+// backoff doubled per attempt, capped at the maximum, with the upper half
+// randomized so concurrent clients do not retry in lockstep
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.initialBackoff
+	for i := 1; i < attempt && delay < p.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.maxBackoff {
+		delay = p.maxBackoff
+	}
+
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// retryableError is a failure that may succeed when the request is repeated
+type retryableError struct {
+	err error
+	// reason is a short description for the retry report, e.g. HTTP 503
+	reason string
+	// retryAfter is the delay requested by Loki, if any
+	retryAfter    time.Duration
+	hasRetryAfter bool
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// retryableStatus reports whether an HTTP status is worth retrying: rate
+// limiting and the errors Loki returns while overloaded or restarting
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryableNetworkError reports whether a transport error is caused by a
+// connection that was refused or dropped, e.g. by a restarting query frontend
+func retryableNetworkError(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an
+// HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// retryStats records the retries made during a tool call so they can be
+// reported in the tool result
+type retryStats struct {
+	mu      sync.Mutex
+	retries int
+	reasons map[string]int
+}
+
+func newRetryStats() *retryStats {
+	return &retryStats{reasons: make(map[string]int)}
+}
+
+// record counts a retry caused by the given reason
+func (s *retryStats) record(reason string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retries++
+	s.reasons[reason]++
+}
+
+// summary describes the retries made, or returns "" if there were none
+func (s *retryStats) summary() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.retries == 0 {
+		return ""
+	}
+
+	reasons := make([]string, 0, len(s.reasons))
+	for reason, count := range s.reasons {
+		reasons = append(reasons, fmt.Sprintf("%s x%d", reason, count))
+	}
+	sort.Strings(reasons)
+
+	noun := "retries"
+	if s.retries == 1 {
+		noun = "retry"
+	}
+	return fmt.Sprintf("Note: %d %s after transient Loki errors (%s)", s.retries, noun, strings.Join(reasons, ", "))
+}
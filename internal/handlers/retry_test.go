@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
+)
+
+// flakyLokiServer answers with the given failures before succeeding, counting the requests it received
+func flakyLokiServer(t *testing.T, requests *int32, failures ...func(w http.ResponseWriter)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(requests, 1))
+		if n <= len(failures) {
+			failures[n-1](w)
+			return
+		}
+		w.Write([]byte(lokiEmptyResponse))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// failWith returns a failure answering with the given status and Retry-After header
+func failWith(status int, retryAfter string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		http.Error(w, http.StatusText(status), status)
+	}
+}
+
+// TestExecuteLokiRequest_Retries tests that transient failures are retried and reported in the result
+func TestExecuteLokiRequest_Retries(t *testing.T) {
+	t.Setenv(config.EnvLokiRetryInitialBackoff, "1ms")
+
+	var requests int32
+	server := flakyLokiServer(t, &requests,
+		failWith(http.StatusServiceUnavailable, ""),
+		failWith(http.StatusServiceUnavailable, ""),
+	)
+
+	result, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`, "url": server.URL}))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", requests)
+	}
+	if text := resultText(t, result); !strings.HasSuffix(text, "\n\nNote: 2 retries after transient Loki errors (HTTP 503 x2)") {
+		t.Errorf("Expected a retry note, got:\n%s", text)
+	}
+}
+
+// TestExecuteLokiRequest_RetryAfter tests that Retry-After is honored, and that long delays are not waited for
+func TestExecuteLokiRequest_RetryAfter(t *testing.T) {
+	var requests int32
+	server := flakyLokiServer(t, &requests, failWith(http.StatusTooManyRequests, "0"))
+
+	result, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`, "url": server.URL}))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if text := resultText(t, result); !strings.Contains(text, "Note: 1 retry after transient Loki errors (HTTP 429 x1)") {
+		t.Errorf("Expected a retry note, got:\n%s", text)
+	}
+
+	requests = 0
+	server = flakyLokiServer(t, &requests, failWith(http.StatusTooManyRequests, "120"))
+	_, err = HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`, "url": server.URL}))
+	if err == nil || !strings.Contains(err.Error(), "retry after 2m0s") {
+		t.Errorf("Expected Retry-After error, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected no retry beyond the maximum backoff, got %d requests", requests)
+	}
+}
+
+// TestExecuteLokiRequest_RetryLimits tests that client errors are not retried and that retries give up
+func TestExecuteLokiRequest_RetryLimits(t *testing.T) {
+	t.Setenv(config.EnvLokiRetryInitialBackoff, "1ms")
+	t.Setenv(config.EnvLokiRetryMaxAttempts, "2")
+
+	var requests int32
+	server := flakyLokiServer(t, &requests, failWith(http.StatusBadRequest, ""))
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app=`, "url": server.URL})); err == nil {
+		t.Errorf("Expected a query error")
+	}
+	if requests != 1 {
+		t.Errorf("Expected a bad request not to be retried, got %d requests", requests)
+	}
+
+	requests = 0
+	server = flakyLokiServer(t, &requests,
+		failWith(http.StatusBadGateway, ""),
+		failWith(http.StatusBadGateway, ""),
+		failWith(http.StatusBadGateway, ""),
+	)
+	_, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`, "url": server.URL}))
+	if err == nil || !strings.Contains(err.Error(), "gave up after 2 attempts") {
+		t.Errorf("Expected to give up after 2 attempts, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+}
+
+// TestRetryPolicy_Backoff tests that the backoff grows exponentially within its jitter bounds
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := retryPolicyFor(config.RetryConfig{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+
+	bounds := map[int][2]time.Duration{
+		1:  {50 * time.Millisecond, 100 * time.Millisecond},
+		2:  {100 * time.Millisecond, 200 * time.Millisecond},
+		3:  {200 * time.Millisecond, 400 * time.Millisecond},
+		10: {500 * time.Millisecond, time.Second},
+	}
+	for attempt, bound := range bounds {
+		for i := 0; i < 20; i++ {
+			if delay := policy.backoff(attempt); delay < bound[0] || delay > bound[1] {
+				t.Errorf("Attempt %d: delay %s outside [%s, %s]", attempt, delay, bound[0], bound[1])
+			}
+		}
+	}
+}
+
+// TestParseRetryAfter tests Retry-After values in seconds and as HTTP dates
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]time.Duration{
+		"5":                             5 * time.Second,
+		"Sat, 17 Oct 2026 12:00:30 GMT": 30 * time.Second,
+		"Sat, 17 Oct 2026 11:00:00 GMT": 0,
+	}
+	for value, expected := range testCases {
+		if delay, ok := parseRetryAfter(value, now); !ok || delay != expected {
+			t.Errorf("%q: expected %s, got %s (ok=%v)", value, expected, delay, ok)
+		}
+	}
+
+	for _, value := range []string{"", "soon", "-1"} {
+		if _, ok := parseRetryAfter(value, now); ok {
+			t.Errorf("%q: expected no delay", value)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// DefaultSeriesLimit is the default maximum number of series returned by loki_series
+const DefaultSeriesLimit = 100
+
+// LokiSeriesResult represents the response of the Loki series endpoint
+type LokiSeriesResult struct {
+	Status string              `json:"status"`
+	Data   []map[string]string `json:"data"`
+	Error  string              `json:"error,omitempty"`
+}
+
+// NewLokiSeriesTool creates and returns a tool for listing the streams matching a selector
+func NewLokiSeriesTool() mcp.Tool {
+	options := []mcp.ToolOption{
+		mcp.WithDescription("List the unique stream label sets in Grafana Loki that match one or more stream selectors. Use this to see which streams exist before pulling raw logs"),
+		mcp.WithArray("match",
+			mcp.Required(),
+			mcp.Description("One or more stream selectors, e.g. [\"{app=\\\"api\\\"}\"]"),
+			mcp.Items(map[string]any{"type": "string"}),
+		),
+	}
+	options = append(options, lokiConnectionOptions()...)
+	options = append(options,
+		mcp.WithString("start",
+			mcp.Description("Start time for the lookup (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the lookup (default: now)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum number of series to return (default: %d)", DefaultSeriesLimit)),
+		),
+	)
+
+	return mcp.NewTool("loki_series", options...)
+}
+
+// HandleLokiSeries handles Loki series tool requests
+func HandleLokiSeries(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	matchers, err := matchersFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := lokiConnectionFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, err := conn.timeRangeFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := DefaultSeriesLimit
+	if limitVal, ok := request.Params.Arguments["limit"].(float64); ok && limitVal > 0 {
+		limit = int(limitVal)
+	}
+
+	params := url.Values{}
+	params["match[]"] = matchers
+	params.Set("start", strconv.FormatInt(start, 10))
+	params.Set("end", strconv.FormatInt(end, 10))
+
+	seriesURL, err := buildLokiURL(conn.URL, "series", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query URL: %v", err)
+	}
+
+	var result LokiSeriesResult
+	if err := executeLokiRequest(ctx, seriesURL, conn, &result); err != nil {
+		return nil, fmt.Errorf("series query failed: %v", err)
+	}
+
+	// Check for Loki errors
+	if result.Status == "error" {
+		return nil, fmt.Errorf("series query failed: loki error: %s", result.Error)
+	}
+
+	return conn.toolResultText(formatSeries(result.Data, limit)), nil
+}
+
+// matchersFromRequest extracts the match argument, accepting either a list of
+// selectors or a single selector string
+func matchersFromRequest(request mcp.CallToolRequest) ([]string, error) {
+	var matchers []string
+	switch match := request.Params.Arguments["match"].(type) {
+	case string:
+		if match != "" {
+			matchers = append(matchers, match)
+		}
+	case []any:
+		for _, m := range match {
+			s, ok := m.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid match parameter: expected strings, got %T", m)
+			}
+			if s != "" {
+				matchers = append(matchers, s)
+			}
+		}
+	case []string:
+		for _, s := range match {
+			if s != "" {
+				matchers = append(matchers, s)
+			}
+		}
+	}
+
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("match parameter is required")
+	}
+	return matchers, nil
+}
+
+// formatSeries formats a list of label sets as compact selectors, removing
+// duplicates and returning at most limit entries
+func formatSeries(series []map[string]string, limit int) string {
+	seen := make(map[string]bool, len(series))
+	var unique []string
+	for _, labels := range series {
+		selector := formatSelector(labels)
+		if seen[selector] {
+			continue
+		}
+		seen[selector] = true
+		unique = append(unique, selector)
+	}
+
+	if len(unique) == 0 {
+		return "No series found matching the selectors"
+	}
+	sort.Strings(unique)
+
+	var b strings.Builder
+	if len(unique) > limit {
+		fmt.Fprintf(&b, "Found %d series (showing first %d):\n", len(unique), limit)
+		unique = unique[:limit]
+	} else {
+		fmt.Fprintf(&b, "Found %d series:\n", len(unique))
+	}
+	for _, selector := range unique {
+		fmt.Fprintf(&b, "%s\n", selector)
+	}
+	return b.String()
+}
+
+// formatSelector formats a label set as a LogQL stream selector with sorted label names
+func formatSelector(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", name, strconv.Quote(labels[name])))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
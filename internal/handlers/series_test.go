@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestHandleLokiSeries tests that series are requested with match[] parameters and deduplicated
+func TestHandleLokiSeries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/series" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		matchers := r.URL.Query()["match[]"]
+		if len(matchers) != 2 || matchers[0] != `{app="api"}` || matchers[1] != `{app="web"}` {
+			t.Errorf("Unexpected matchers: %v", matchers)
+		}
+		w.Write([]byte(`{"status":"success","data":[
+			{"app":"web","job":"b"},
+			{"job":"a","app":"api"},
+			{"app":"api","job":"a"}
+		]}`))
+	}))
+	defer server.Close()
+
+	result, err := HandleLokiSeries(context.Background(), newCallToolRequest(map[string]any{
+		"url":   server.URL,
+		"match": []any{`{app="api"}`, `{app="web"}`},
+		"start": "2024-01-15T10:00:00Z",
+		"end":   "2024-01-15T11:00:00Z",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiSeries failed: %v", err)
+	}
+
+	expected := "Found 2 series:\n{app=\"api\", job=\"a\"}\n{app=\"web\", job=\"b\"}\n\nTime range: 2024-01-15T10:00:00Z to 2024-01-15T11:00:00Z (1h)"
+	if output := resultText(t, result); output != expected {
+		t.Errorf("Expected %q, got %q", expected, output)
+	}
+}
+
+// TestHandleLokiSeries_MissingMatch tests that at least one selector is required
+func TestHandleLokiSeries_MissingMatch(t *testing.T) {
+	_, err := HandleLokiSeries(context.Background(), newCallToolRequest(map[string]any{"match": []any{}}))
+	if err == nil || !strings.Contains(err.Error(), "match parameter is required") {
+		t.Errorf("Expected missing match error, got %v", err)
+	}
+}
+
+// TestFormatSeries_Limit tests that the number of series returned is capped
+func TestFormatSeries_Limit(t *testing.T) {
+	series := []map[string]string{
+		{"pod": "c"},
+		{"pod": "a"},
+		{"pod": "b"},
+	}
+
+	output := formatSeries(series, 2)
+	expected := "Found 3 series (showing first 2):\n{pod=\"a\"}\n{pod=\"b\"}\n"
+	if output != expected {
+		t.Errorf("Expected %q, got %q", expected, output)
+	}
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Aggregation modes supported by the Loki volume endpoints
+const (
+	VolumeAggregateBySeries = "series"
+	VolumeAggregateByLabels = "labels"
+)
+
+// LokiIndexStats represents the response of the Loki index stats endpoint
+type LokiIndexStats struct {
+	Streams uint64 `json:"streams"`
+	Chunks  uint64 `json:"chunks"`
+	Bytes   uint64 `json:"bytes"`
+	Entries uint64 `json:"entries"`
+}
+
+// NewLokiIndexStatsTool creates and returns a tool for estimating the size of a query
+func NewLokiIndexStatsTool() mcp.Tool {
+	options := []mcp.ToolOption{
+		mcp.WithDescription("Get index statistics (streams, chunks, entries and bytes) for a stream selector and time range from Grafana Loki. Use this to estimate how much data a query will scan before running loki_query"),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("LogQL stream selector, e.g. {app=\"api\"}"),
+		),
+	}
+	options = append(options, lokiConnectionOptions()...)
+	options = append(options,
+		mcp.WithString("start",
+			mcp.Description("Start time for the lookup (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the lookup (default: now)"),
+		),
+	)
+
+	return mcp.NewTool("loki_index_stats", options...)
+}
+
+// NewLokiVolumeTool creates and returns a tool for querying log volume per label set
+func NewLokiVolumeTool() mcp.Tool {
+	return mcp.NewTool("loki_volume", volumeToolOptions(
+		"Get the log volume in bytes for a stream selector over a time range from Grafana Loki, broken down by series or label. Use this to find which label values dominate volume before running loki_query",
+		false,
+	)...)
+}
+
+// NewLokiVolumeRangeTool creates and returns a tool for querying log volume over time
+func NewLokiVolumeRangeTool() mcp.Tool {
+	return mcp.NewTool("loki_volume_range", volumeToolOptions(
+		"Get the log volume in bytes for a stream selector from Grafana Loki as a time series, broken down by series or label",
+		true,
+	)...)
+}
+
+// volumeToolOptions returns the tool options shared by the volume tools
+func volumeToolOptions(description string, withStep bool) []mcp.ToolOption {
+	options := []mcp.ToolOption{
+		mcp.WithDescription(description),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("LogQL stream selector, e.g. {app=\"api\"}"),
+		),
+	}
+	options = append(options, lokiConnectionOptions()...)
+	options = append(options,
+		mcp.WithString("start",
+			mcp.Description("Start time for the lookup (default: 1h ago)"),
+		),
+		mcp.WithString("end",
+			mcp.Description("End time for the lookup (default: now)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of volumes to return (default: 100)"),
+		),
+		mcp.WithString("target_labels",
+			mcp.Description("Comma-separated list of labels to aggregate volume by, e.g. app,namespace"),
+		),
+		mcp.WithString("aggregate_by",
+			mcp.Description("Aggregate volume by full series or by individual labels (default: series)"),
+			mcp.Enum(VolumeAggregateBySeries, VolumeAggregateByLabels),
+		),
+	)
+	if withStep {
+		options = append(options,
+			mcp.WithString("step",
+				mcp.Description("Query resolution step as a duration, e.g. 5m (default: chosen by Loki)"),
+			),
+		)
+	}
+	return options
+}
+
+// HandleLokiIndexStats handles Loki index stats tool requests
+func HandleLokiIndexStats(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, ok := request.Params.Arguments["query"].(string)
+	if !ok || query == "" {
+		return nil, fmt.Errorf("query parameter is required")
+	}
+	conn, err := lokiConnectionFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, err := conn.timeRangeFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", strconv.FormatInt(start, 10))
+	params.Set("end", strconv.FormatInt(end, 10))
+
+	statsURL, err := buildLokiURL(conn.URL, "index/stats", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query URL: %v", err)
+	}
+
+	var stats LokiIndexStats
+	if err := executeLokiRequest(ctx, statsURL, conn, &stats); err != nil {
+		return nil, fmt.Errorf("index stats query failed: %v", err)
+	}
+
+	return conn.toolResultText(formatIndexStats(query, stats)), nil
+}
+
+// HandleLokiVolume handles Loki volume tool requests
+func HandleLokiVolume(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return handleLokiVolume(ctx, request, "index/volume")
+}
+
+// HandleLokiVolumeRange handles Loki volume range tool requests
+func HandleLokiVolumeRange(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return handleLokiVolume(ctx, request, "index/volume_range")
+}
+
+// handleLokiVolume queries one of the volume endpoints and formats the result
+func handleLokiVolume(ctx context.Context, request mcp.CallToolRequest, endpoint string) (*mcp.CallToolResult, error) {
+	args := request.Params.Arguments
+	query, ok := args["query"].(string)
+	if !ok || query == "" {
+		return nil, fmt.Errorf("query parameter is required")
+	}
+	conn, err := lokiConnectionFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end, err := conn.timeRangeFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", strconv.FormatInt(start, 10))
+	params.Set("end", strconv.FormatInt(end, 10))
+	params.Set("limit", strconv.Itoa(DefaultQueryLimit))
+
+	if limitVal, ok := args["limit"].(float64); ok && limitVal > 0 {
+		params.Set("limit", strconv.Itoa(int(limitVal)))
+	}
+	if targetLabels, ok := args["target_labels"].(string); ok && targetLabels != "" {
+		params.Set("targetLabels", targetLabels)
+	}
+	if aggregateBy, ok := args["aggregate_by"].(string); ok && aggregateBy != "" {
+		if aggregateBy != VolumeAggregateBySeries && aggregateBy != VolumeAggregateByLabels {
+			return nil, fmt.Errorf("invalid aggregate_by: %s (must be %s or %s)", aggregateBy, VolumeAggregateBySeries, VolumeAggregateByLabels)
+		}
+		params.Set("aggregateBy", aggregateBy)
+	}
+	if step, ok := args["step"].(string); ok && step != "" {
+		params.Set("step", step)
+	}
+
+	volumeURL, err := buildLokiURL(conn.URL, endpoint, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query URL: %v", err)
+	}
+
+	result, err := executeLokiQuery(ctx, volumeURL, conn)
+	if err != nil {
+		return nil, fmt.Errorf("volume query failed: %v", err)
+	}
+
+	loc, err := defaultLocation()
+	if err != nil {
+		return nil, err
+	}
+	return conn.toolResultText(formatVolumeResults(result.Data.Metrics, loc)), nil
+}
+
+// formatIndexStats formats index statistics for a query
+func formatIndexStats(query string, stats LokiIndexStats) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Index statistics for %s:\n", query)
+	fmt.Fprintf(&b, "Streams: %d\n", stats.Streams)
+	fmt.Fprintf(&b, "Chunks: %d\n", stats.Chunks)
+	fmt.Fprintf(&b, "Entries: %d\n", stats.Entries)
+	fmt.Fprintf(&b, "Bytes: %s (%d bytes)\n", formatBytes(stats.Bytes), stats.Bytes)
+	return b.String()
+}
+
+// formatVolumeResults formats volume results, largest first. Matrix results
+// are summed over time and followed by their individual samples, with times
+// in loc.
+func formatVolumeResults(metrics []LokiMetric, loc *time.Location) string {
+	if len(metrics) == 0 {
+		return "No volume found matching the query"
+	}
+
+	type volume struct {
+		metric LokiMetric
+		total  uint64
+	}
+	volumes := make([]volume, 0, len(metrics))
+	var total uint64
+	for _, metric := range metrics {
+		samples := metric.Values
+		if metric.Value != nil {
+			samples = []LokiSample{*metric.Value}
+		}
+		var sum uint64
+		for _, sample := range samples {
+			bytes, err := strconv.ParseFloat(sample.Value, 64)
+			if err == nil && bytes > 0 {
+				sum += uint64(bytes)
+			}
+		}
+		volumes = append(volumes, volume{metric: metric, total: sum})
+		total += sum
+	}
+	sort.SliceStable(volumes, func(i, j int) bool {
+		return volumes[i].total > volumes[j].total
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d volumes totalling %s:\n\n", len(volumes), formatBytes(total))
+	for _, v := range volumes {
+		share := 0.0
+		if total > 0 {
+			share = float64(v.total) / float64(total) * 100
+		}
+		fmt.Fprintf(&b, "%s: %s (%.1f%%)\n", formatSelector(v.metric.Metric), formatBytes(v.total), share)
+		for _, sample := range v.metric.Values {
+			bytes, _ := strconv.ParseFloat(sample.Value, 64)
+			fmt.Fprintf(&b, "  [%s] %s\n", sample.Time().In(loc).Format(time.RFC3339Nano), formatBytes(uint64(bytes)))
+		}
+	}
+	return b.String()
+}
+
+// formatBytes formats a byte count using decimal units, e.g. 400GB
+func formatBytes(bytes uint64) string {
+	const unit = 1000
+	if bytes < unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	div, exp := uint64(unit), 0
+	for n := bytes / unit; n >= unit && exp < 5; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
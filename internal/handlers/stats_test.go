@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestHandleLokiIndexStats tests that index statistics are fetched and rendered with readable sizes
+func TestHandleLokiIndexStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/index/stats" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("query") != `{app="api"}` {
+			t.Errorf("Unexpected query: %s", r.URL.Query().Get("query"))
+		}
+		w.Write([]byte(`{"streams":12,"chunks":3400,"bytes":400000000000,"entries":987654}`))
+	}))
+	defer server.Close()
+
+	result, err := HandleLokiIndexStats(context.Background(), newCallToolRequest(map[string]any{
+		"url":   server.URL,
+		"query": `{app="api"}`,
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiIndexStats failed: %v", err)
+	}
+
+	output := resultText(t, result)
+	for _, expected := range []string{"Streams: 12", "Chunks: 3400", "Entries: 987654", "Bytes: 400.0GB (400000000000 bytes)"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, but got:\n%s", expected, output)
+		}
+	}
+}
+
+// TestHandleLokiVolume tests that volumes are requested with the aggregation parameters and sorted by size
+func TestHandleLokiVolume(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/index/volume" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("targetLabels") != "app" || q.Get("aggregateBy") != "labels" {
+			t.Errorf("Unexpected parameters: %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"app":"web"},"value":[1705312245,"250000"]},
+			{"metric":{"app":"api"},"value":[1705312245,"750000"]}
+		]}}`))
+	}))
+	defer server.Close()
+
+	result, err := HandleLokiVolume(context.Background(), newCallToolRequest(map[string]any{
+		"url":           server.URL,
+		"query":         `{app=~".+"}`,
+		"target_labels": "app",
+		"aggregate_by":  "labels",
+		"start":         "2024-01-15T10:00:00Z",
+		"end":           "2024-01-15T11:00:00Z",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiVolume failed: %v", err)
+	}
+
+	expected := "Found 2 volumes totalling 1.0MB:\n\n{app=\"api\"}: 750.0KB (75.0%)\n{app=\"web\"}: 250.0KB (25.0%)\n\nTime range: 2024-01-15T10:00:00Z to 2024-01-15T11:00:00Z (1h)"
+	if output := resultText(t, result); output != expected {
+		t.Errorf("Expected %q, got %q", expected, output)
+	}
+}
+
+// TestHandleLokiVolumeRange tests that range volumes are summed over time
+func TestHandleLokiVolumeRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/index/volume_range" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("step") != "1h" {
+			t.Errorf("Unexpected step: %s", r.URL.Query().Get("step"))
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"app":"api"},"values":[[1705312245,"1000"],[1705315845,"2000"]]}
+		]}}`))
+	}))
+	defer server.Close()
+
+	result, err := HandleLokiVolumeRange(context.Background(), newCallToolRequest(map[string]any{
+		"url":   server.URL,
+		"query": `{app="api"}`,
+		"step":  "1h",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiVolumeRange failed: %v", err)
+	}
+
+	output := resultText(t, result)
+	if !strings.Contains(output, "{app=\"api\"}: 3.0KB (100.0%)") || strings.Count(output, "  [2024-01-15T") != 2 {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+}
+
+// TestFormatBytes tests human-readable byte formatting
+func TestFormatBytes(t *testing.T) {
+	testCases := map[uint64]string{
+		0:             "0B",
+		999:           "999B",
+		1500:          "1.5KB",
+		2500000:       "2.5MB",
+		400000000000:  "400.0GB",
+		1200000000000: "1.2TB",
+	}
+	for bytes, expected := range testCases {
+		if got := formatBytes(bytes); got != expected {
+			t.Errorf("formatBytes(%d) = %s, expected %s", bytes, got, expected)
+		}
+	}
+}
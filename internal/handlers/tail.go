@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Bounds for the loki_tail tool
+const (
+	DefaultTailDuration = 10 * time.Second
+	MaxTailDuration     = 5 * time.Minute
+	DefaultTailMaxLines = 100
+	MaxTailDelayFor     = 5
+)
+
+// tailProgressInterval is how often progress is reported while tailing, so
+// clients see the tail advance even when no lines arrive
+var tailProgressInterval = 5 * time.Second
+
+// LokiTailMessage represents a single message received from the Loki tail WebSocket
+type LokiTailMessage struct {
+	Streams        []LokiEntry        `json:"streams"`
+	DroppedEntries []LokiDroppedEntry `json:"dropped_entries"`
+}
+
+// LokiDroppedEntry represents an entry Loki dropped because the client could not keep up
+type LokiDroppedEntry struct {
+	Labels    map[string]string `json:"labels"`
+	Timestamp string            `json:"timestamp"`
+}
+
+// NewLokiTailTool creates and returns a tool for following logs as they arrive
+func NewLokiTailTool() mcp.Tool {
+	options := []mcp.ToolOption{
+		mcp.WithDescription("Follow logs from Grafana Loki as they arrive for a bounded duration or number of lines, then return the collected entries"),
+		mcp.WithString("query",
+			mcp.Required(),
+			mcp.Description("LogQL query string"),
+		),
+	}
+	options = append(options, lokiConnectionOptions()...)
+	options = append(options,
+		mcp.WithString("duration",
+			mcp.Description(fmt.Sprintf("How long to follow the logs, e.g. 30s (default: %s, max: %s)", DefaultTailDuration, MaxTailDuration)),
+		),
+		mcp.WithNumber("max_lines",
+			mcp.Description(fmt.Sprintf("Stop after collecting this many lines (default: %d)", DefaultTailMaxLines)),
+		),
+		mcp.WithString("start",
+			mcp.Description("Start time to replay logs from before following (default: now)"),
+		),
+		mcp.WithNumber("delay_for",
+			mcp.Description(fmt.Sprintf("Seconds to delay retrieving logs to let slow loggers catch up (default: 0, max: %d)", MaxTailDelayFor)),
+		),
+	)
+	options = append(options, displayOptions()...)
+	options = append(options, budgetOptions()...)
+	options = append(options, dedupOption())
+
+	return mcp.NewTool("loki_tail", options...)
+}
+
+// HandleLokiTail handles Loki tail tool requests
+func HandleLokiTail(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.Params.Arguments
+	queryString, ok := args["query"].(string)
+	if !ok || queryString == "" {
+		return nil, fmt.Errorf("query parameter is required")
+	}
+	conn, err := lokiConnectionFromRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set defaults for optional parameters
+	duration := DefaultTailDuration
+	maxLines := DefaultTailMaxLines
+	start := time.Now().UnixNano()
+	delayFor := 0
+
+	// Override defaults if parameters are provided
+	if durationStr, ok := args["duration"].(string); ok && durationStr != "" {
+		d, err := time.ParseDuration(durationStr)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration: %s", durationStr)
+		}
+		if d > MaxTailDuration {
+			d = MaxTailDuration
+		}
+		duration = d
+	}
+
+	if maxLinesVal, ok := args["max_lines"].(float64); ok && maxLinesVal > 0 {
+		maxLines = int(maxLinesVal)
+	}
+
+	if startStr, ok := args["start"].(string); ok && startStr != "" {
+		startTime, err := parseTime(startStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start time: %v", err)
+		}
+		start = startTime.UnixNano()
+	}
+
+	if delayVal, ok := args["delay_for"].(float64); ok {
+		if delayVal < 0 || delayVal > MaxTailDelayFor {
+			return nil, fmt.Errorf("invalid delay_for: must be between 0 and %d", MaxTailDelayFor)
+		}
+		delayFor = int(delayVal)
+	}
+
+	tailURL, err := buildLokiTailURL(conn.URL, queryString, start, maxLines, delayFor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tail URL: %v", err)
+	}
+
+	tailCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+
+	collector := newTailCollector(maxLines)
+	if collector.opts, err = conn.formatOptionsFromRequest(args); err != nil {
+		return nil, err
+	}
+	progress := newTailProgress(ctx, request, duration, maxLines)
+	stopProgress := progress.run(tailCtx)
+	reason, err := tailLoki(tailCtx, tailURL, conn, func(msg LokiTailMessage) bool {
+		done := collector.add(msg)
+		progress.report(collector.lines)
+		return done
+	})
+	stopProgress()
+	if err != nil {
+		return nil, fmt.Errorf("tail failed: %v", err)
+	}
+
+	return mcp.NewToolResultText(collector.format(reason)), nil
+}
+
+// buildLokiTailURL constructs the WebSocket URL of the Loki tail endpoint
+func buildLokiTailURL(baseURL, query string, start int64, limit, delayFor int) (string, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", strconv.FormatInt(start, 10))
+	params.Set("limit", strconv.Itoa(limit))
+	if delayFor > 0 {
+		params.Set("delay_for", strconv.Itoa(delayFor))
+	}
+
+	tailURL, err := buildLokiURL(baseURL, "tail", params)
+	if err != nil {
+		return "", err
+	}
+
+	// The tail endpoint is served over WebSocket
+	switch {
+	case strings.HasPrefix(tailURL, "https://"):
+		tailURL = "wss://" + strings.TrimPrefix(tailURL, "https://")
+	case strings.HasPrefix(tailURL, "http://"):
+		tailURL = "ws://" + strings.TrimPrefix(tailURL, "http://")
+	}
+	return tailURL, nil
+}
+
+// tailLoki reads messages from the tail WebSocket until the context is done,
+// the server closes the connection or handle returns true. It returns a short
+// description of why tailing stopped.
+func tailLoki(ctx context.Context, tailURL string, conn lokiConnection, handle func(LokiTailMessage) bool) (string, error) {
+	header := http.Header{}
+	if err := conn.applyHeaders(header); err != nil {
+		return "", err
+	}
+
+	// Dial with the same TLS and proxy settings as the other Loki tools
+	transport, err := httpTransportFor(conn.TLS, conn.HTTP)
+	if err != nil {
+		return "", err
+	}
+	handshakeTimeout := conn.Timeout
+	if handshakeTimeout <= 0 {
+		handshakeTimeout = defaultRequestTimeout
+	}
+	dialer := websocket.Dialer{
+		Proxy:            transport.Proxy,
+		NetDialContext:   transport.DialContext,
+		TLSClientConfig:  transport.TLSClientConfig,
+		HandshakeTimeout: handshakeTimeout,
+	}
+	ws, resp, err := dialer.DialContext(ctx, tailURL, header)
+	if err != nil {
+		if resp != nil {
+			return "", fmt.Errorf("HTTP error: %d - %v", resp.StatusCode, err)
+		}
+		return "", err
+	}
+	defer ws.Close()
+
+	// Unblock the read loop once the duration has elapsed
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			ws.Close()
+		case <-stop:
+		}
+	}()
+
+	for {
+		var msg LokiTailMessage
+		if err := ws.ReadJSON(&msg); err != nil {
+			if ctx.Err() != nil {
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					return "duration elapsed", nil
+				}
+				return "", ctx.Err()
+			}
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return "connection closed by Loki", nil
+			}
+			return "", err
+		}
+
+		if handle(msg) {
+			ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			return "line limit reached", nil
+		}
+	}
+}
+
+// tailCollector accumulates tailed entries per stream
+type tailCollector struct {
+	maxLines int
+	opts     formatOptions
+	lines    int
+	streams  []LokiEntry
+	index    map[string]int
+	dropped  int
+}
+
+func newTailCollector(maxLines int) *tailCollector {
+	return &tailCollector{
+		maxLines: maxLines,
+		index:    make(map[string]int),
+	}
+}
+
+// add records the entries of a tail message and reports whether the line
+// limit has been reached
+func (c *tailCollector) add(msg LokiTailMessage) bool {
+	c.dropped += len(msg.DroppedEntries)
+
+	for _, stream := range msg.Streams {
+		key := formatSelector(stream.Stream)
+		i, ok := c.index[key]
+		if !ok {
+			i = len(c.streams)
+			c.index[key] = i
+			c.streams = append(c.streams, LokiEntry{Stream: stream.Stream})
+		}
+
+		for _, value := range stream.Values {
+			if c.lines >= c.maxLines {
+				return true
+			}
+			c.streams[i].Values = append(c.streams[i].Values, value)
+			c.lines++
+		}
+	}
+
+	return c.lines >= c.maxLines
+}
+
+// format renders the collected entries along with why tailing stopped
+func (c *tailCollector) format(reason string) string {
+	output := fmt.Sprintf("Tailed %d lines (%s)", c.lines, reason)
+	if c.dropped > 0 {
+		output += fmt.Sprintf(", %d entries dropped by Loki", c.dropped)
+	}
+	output += "\n\n"
+
+	if c.lines == 0 {
+		return output + "No logs received while tailing"
+	}
+	return output + formatStreamResults(c.streams, c.opts)
+}
+
+// tailProgress reports the elapsed time of a tail against its duration,
+// along with the number of lines collected, as MCP progress notifications
+type tailProgress struct {
+	ctx      context.Context
+	request  mcp.CallToolRequest
+	started  time.Time
+	duration time.Duration
+	maxLines int
+
+	mu    sync.Mutex
+	lines int
+	last  float64
+}
+
+func newTailProgress(ctx context.Context, request mcp.CallToolRequest, duration time.Duration, maxLines int) *tailProgress {
+	return &tailProgress{
+		ctx:      ctx,
+		request:  request,
+		started:  time.Now(),
+		duration: duration,
+		maxLines: maxLines,
+	}
+}
+
+// run reports progress every tailProgressInterval until ctx is done or the
+// returned function is called
+func (p *tailProgress) run(ctx context.Context) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(tailProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.report(-1)
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// report sends a progress notification with the number of lines collected,
+// or the last known number if lines is negative
+func (p *tailProgress) report(lines int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if lines >= 0 {
+		p.lines = lines
+	}
+
+	// Progress must increase with every notification
+	elapsed := min(time.Since(p.started), p.duration).Seconds()
+	if elapsed <= p.last {
+		return
+	}
+	p.last = elapsed
+
+	message := fmt.Sprintf("%d of %d lines after %s of %s", p.lines, p.maxLines, time.Duration(elapsed*float64(time.Second)).Round(time.Second), p.duration)
+	sendProgress(p.ctx, p.request, elapsed, p.duration.Seconds(), message)
+}
+
+// sendProgress emits an MCP progress notification if the client asked for one
+func sendProgress(ctx context.Context, request mcp.CallToolRequest, progress, total float64, message string) {
+	if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return
+	}
+	srv := server.ServerFromContext(ctx)
+	if srv == nil {
+		return
+	}
+
+	// Progress is best effort; a slow client must not stall the tail
+	_ = srv.SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+		"progressToken": request.Params.Meta.ProgressToken,
+		"progress":      progress,
+		"total":         total,
+		"message":       message,
+	})
+}
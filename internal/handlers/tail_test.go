@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// newTailServer starts a WebSocket stand-in for the Loki tail endpoint that
+// sends the given messages and then keeps the connection open
+func newTailServer(t *testing.T, messages ...string) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/loki/api/v1/tail" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("query") != `{app="api"}` {
+			t.Errorf("Unexpected query: %s", r.URL.Query().Get("query"))
+		}
+		if r.Header.Get("Authorization") != "Bearer abc" {
+			t.Errorf("Unexpected Authorization header: %s", r.Header.Get("Authorization"))
+		}
+
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Upgrade failed: %v", err)
+			return
+		}
+		defer ws.Close()
+
+		for _, msg := range messages {
+			if err := ws.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+				return
+			}
+		}
+
+		// Wait for the client to hang up
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+// TestHandleLokiTail_LineLimit tests that tailing stops once max_lines entries have been collected
+func TestHandleLokiTail_LineLimit(t *testing.T) {
+	server := newTailServer(t,
+		`{"streams":[{"stream":{"app":"api"},"values":[["1705312245000000000","first"],["1705312246000000000","second"]]}]}`,
+		`{"streams":[{"stream":{"app":"api"},"values":[["1705312247000000000","third"],["1705312248000000000","fourth"]]}],"dropped_entries":[{"labels":{"app":"api"},"timestamp":"1705312247500000000"}]}`,
+	)
+	defer server.Close()
+
+	result, err := HandleLokiTail(context.Background(), newCallToolRequest(map[string]any{
+		"url":       server.URL,
+		"token":     "abc",
+		"query":     `{app="api"}`,
+		"max_lines": float64(3),
+		"duration":  "5s",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiTail failed: %v", err)
+	}
+
+	output := resultText(t, result)
+	if !strings.HasPrefix(output, "Tailed 3 lines (line limit reached), 1 entries dropped by Loki") {
+		t.Errorf("Unexpected summary:\n%s", output)
+	}
+	if !strings.Contains(output, "third") || strings.Contains(output, "fourth") {
+		t.Errorf("Expected exactly the first three lines, got:\n%s", output)
+	}
+	if strings.Count(output, "Stream (app=api)") != 1 {
+		t.Errorf("Expected entries to be merged into a single stream, got:\n%s", output)
+	}
+}
+
+// TestHandleLokiTail_Duration tests that tailing stops once the duration has elapsed
+func TestHandleLokiTail_Duration(t *testing.T) {
+	server := newTailServer(t,
+		`{"streams":[{"stream":{"app":"api"},"values":[["1705312245000000000","only line"]]}]}`,
+	)
+	defer server.Close()
+
+	started := time.Now()
+	result, err := HandleLokiTail(context.Background(), newCallToolRequest(map[string]any{
+		"url":      server.URL,
+		"token":    "abc",
+		"query":    `{app="api"}`,
+		"duration": "200ms",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiTail failed: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Tail did not stop after its duration, took %s", elapsed)
+	}
+
+	output := resultText(t, result)
+	if !strings.HasPrefix(output, "Tailed 1 lines (duration elapsed)") || !strings.Contains(output, "only line") {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+}
+
+// TestHandleLokiTail_InvalidDuration tests that malformed durations are rejected
+func TestHandleLokiTail_InvalidDuration(t *testing.T) {
+	_, err := HandleLokiTail(context.Background(), newCallToolRequest(map[string]any{
+		"query":    `{app="api"}`,
+		"duration": "soon",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "invalid duration") {
+		t.Errorf("Expected invalid duration error, got %v", err)
+	}
+}
+
+// fakeSession is a minimal initialized MCP client session for capturing notifications
+type fakeSession struct {
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *fakeSession) Initialize()       {}
+func (s *fakeSession) Initialized() bool { return true }
+func (s *fakeSession) SessionID() string { return "test-session" }
+func (s *fakeSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+// TestHandleLokiTail_Progress tests that progress notifications are sent when a progress token is supplied
+func TestHandleLokiTail_Progress(t *testing.T) {
+	lokiServer := newTailServer(t,
+		`{"streams":[{"stream":{"app":"api"},"values":[["1705312245000000000","one"]]}]}`,
+		`{"streams":[{"stream":{"app":"api"},"values":[["1705312246000000000","two"]]}]}`,
+	)
+	defer lokiServer.Close()
+
+	mcpServer := server.NewMCPServer("test", "0.0.0")
+	mcpServer.AddTool(NewLokiTailTool(), HandleLokiTail)
+
+	session := &fakeSession{notifications: make(chan mcp.JSONRPCNotification, 10)}
+	ctx := mcpServer.WithContext(context.Background(), session)
+
+	message, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params": map[string]any{
+			"name": "loki_tail",
+			"arguments": map[string]any{
+				"url":       lokiServer.URL,
+				"token":     "abc",
+				"query":     `{app="api"}`,
+				"max_lines": 2,
+			},
+			"_meta": map[string]any{"progressToken": "tail-1"},
+		},
+	})
+	mcpServer.HandleMessage(ctx, message)
+
+	close(session.notifications)
+	var messages []string
+	for notification := range session.notifications {
+		if notification.Method != "notifications/progress" {
+			continue
+		}
+		if token := notification.Params.AdditionalFields["progressToken"]; token != "tail-1" {
+			t.Errorf("Unexpected progress token: %v", token)
+		}
+		if total := notification.Params.AdditionalFields["total"]; total != DefaultTailDuration.Seconds() {
+			t.Errorf("Expected the duration as total, got %v", total)
+		}
+		messages = append(messages, notification.Params.AdditionalFields["message"].(string))
+	}
+	if len(messages) != 2 || !strings.HasPrefix(messages[0], "1 of 2 lines after ") || !strings.HasPrefix(messages[1], "2 of 2 lines after ") {
+		t.Errorf("Expected progress for each line, got %q", messages)
+	}
+}
+
+// TestHandleLokiTail_ProgressWhileQuiet tests that progress is reported on a stream with no new lines
+func TestHandleLokiTail_ProgressWhileQuiet(t *testing.T) {
+	interval := tailProgressInterval
+	tailProgressInterval = 20 * time.Millisecond
+	defer func() { tailProgressInterval = interval }()
+
+	lokiServer := newTailServer(t)
+	defer lokiServer.Close()
+
+	mcpServer := server.NewMCPServer("test", "0.0.0")
+	mcpServer.AddTool(NewLokiTailTool(), HandleLokiTail)
+
+	session := &fakeSession{notifications: make(chan mcp.JSONRPCNotification, 100)}
+	ctx := mcpServer.WithContext(context.Background(), session)
+
+	message, _ := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params": map[string]any{
+			"name": "loki_tail",
+			"arguments": map[string]any{
+				"url":      lokiServer.URL,
+				"token":    "abc",
+				"query":    `{app="api"}`,
+				"duration": "200ms",
+			},
+			"_meta": map[string]any{"progressToken": "tail-1"},
+		},
+	})
+	mcpServer.HandleMessage(ctx, message)
+
+	close(session.notifications)
+	var progress []float64
+	for notification := range session.notifications {
+		if notification.Method != "notifications/progress" {
+			continue
+		}
+		if msg := notification.Params.AdditionalFields["message"].(string); !strings.HasPrefix(msg, "0 of 100 lines after ") {
+			t.Errorf("Unexpected progress message: %q", msg)
+		}
+		progress = append(progress, notification.Params.AdditionalFields["progress"].(float64))
+	}
+	if len(progress) < 2 {
+		t.Fatalf("Expected periodic progress while no lines arrive, got %v", progress)
+	}
+	for i := 1; i < len(progress); i++ {
+		if progress[i] <= progress[i-1] || progress[i] > 0.2 {
+			t.Errorf("Expected increasing elapsed seconds up to the duration, got %v", progress)
+		}
+	}
+}
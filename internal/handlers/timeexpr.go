@@ -0,0 +1,534 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
+)
+
+// timeUnits maps the unit names accepted in time expressions to their
+// canonical unit. Single letters are case-sensitive so that M (months) and
+// m (minutes) can be told apart; longer names are matched case-insensitively.
+var timeUnits = map[string]string{
+	"ns": "ns", "us": "us", "µs": "us", "ms": "ms",
+	"s": "s", "sec": "s", "secs": "s", "second": "s", "seconds": "s",
+	"m": "m", "min": "m", "mins": "m", "minute": "m", "minutes": "m",
+	"h": "h", "hr": "h", "hrs": "h", "hour": "h", "hours": "h",
+	"d": "d", "day": "d", "days": "d",
+	"w": "w", "wk": "w", "wks": "w", "week": "w", "weeks": "w",
+	"M": "M", "mo": "M", "month": "M", "months": "M",
+	"y": "y", "yr": "y", "yrs": "y", "year": "y", "years": "y",
+}
+
+// fixedUnits are the units with a fixed length
+var fixedUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// Layouts of absolute times without a zone, interpreted in the default
+// timezone. A fractional second is optional in the layouts that allow it.
+var absoluteTimeLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Layouts of a time of day, e.g. in "today 09:00"
+var clockLayouts = []string{
+	"15:04:05.999999999",
+	"15:04",
+	"3PM",
+	"3:04PM",
+}
+
+// defaultLocation returns the timezone in which time expressions without an
+// explicit zone are interpreted: the timezone of the config file, then the
+// LOKI_MCP_TIMEZONE environment variable, then UTC
+func defaultLocation() (*time.Location, error) {
+	if cfg := currentConfig(); cfg != nil && cfg.Timezone != "" {
+		return config.LoadTimezone(cfg.Timezone)
+	}
+	if os.Getenv(config.EnvTimezone) != "" {
+		return config.TimezoneFromEnv()
+	}
+	return time.UTC, nil
+}
+
+// timeParser resolves time expressions against a fixed current time, so the
+// start and end of a range are relative to the same instant
+type timeParser struct {
+	now time.Time
+	loc *time.Location
+}
+
+// newTimeParser returns a parser for the current time in the default timezone
+func newTimeParser() (timeParser, error) {
+	loc, err := defaultLocation()
+	if err != nil {
+		return timeParser{}, err
+	}
+	return timeParser{now: time.Now().In(loc), loc: loc}, nil
+}
+
+// parseTime parses a time expression relative to the current time
+func parseTime(timeStr string) (time.Time, error) {
+	p, err := newTimeParser()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return p.parse(timeStr, false)
+}
+
+// parse resolves a time expression. It accepts Unix timestamps, Grafana
+// style expressions such as now-1h or now-1d/d, durations like 15m or -2d
+// and phrases like "2 hours ago" counted back from now, today, yesterday
+// and tomorrow with an optional time of day, and absolute times with an
+// optional trailing zone such as "2024-01-15 14:00 Europe/Berlin".
+//
+// With roundUp, a rounded expression or a bare day resolves to the last
+// instant of the period instead of its first, as suits the end of a range:
+// now/d then means the end of today.
+func (p timeParser) parse(expr string, roundUp bool) (time.Time, error) {
+	s := strings.TrimSpace(expr)
+	if s == "" {
+		return time.Time{}, fmt.Errorf("empty time expression")
+	}
+
+	// Handle raw Unix timestamps in seconds, milliseconds or nanoseconds
+	if t, ok, err := parseEpoch(s); ok {
+		return t, err
+	}
+
+	s, loc := splitZone(s, p.loc)
+	now := p.now.In(loc)
+	lower := strings.ToLower(s)
+
+	// Handle Grafana style expressions like "now-1h" or "now-1d/d"
+	if lower == "now" || strings.HasPrefix(lower, "now-") || strings.HasPrefix(lower, "now+") || strings.HasPrefix(lower, "now/") ||
+		strings.HasPrefix(lower, "now ") {
+		t, err := parseNowExpr(now, strings.Join(strings.Fields(s[3:]), ""), roundUp)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time expression %q: %v", expr, err)
+		}
+		return t, nil
+	}
+
+	// Handle phrases like "1w ago" or "2 hours ago"
+	// The suffix is matched on s itself, since lowercasing may change the
+	// byte length of the runes before it
+	if len(s) > 3 && strings.EqualFold(s[len(s)-3:], "ago") {
+		offsets, err := parseOffsets(s[:len(s)-3])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time expression %q: %v", expr, err)
+		}
+		return applyOffsets(now, offsets, -1)
+	}
+
+	// Handle durations like "-1h", "15m" or "2d" counted back from now, and
+	// "+1h" counted forward
+	sign, rest := -1, s
+	switch s[0] {
+	case '+':
+		sign, rest = 1, s[1:]
+	case '-':
+		rest = s[1:]
+	}
+	if offsets, err := parseOffsets(rest); err == nil {
+		return applyOffsets(now, offsets, sign)
+	}
+
+	// Handle "today", "yesterday" and "tomorrow" with an optional time of day
+	if t, ok, err := parseDayExpr(now, s, roundUp); ok {
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time expression %q: %v", expr, err)
+		}
+		return t, nil
+	}
+
+	// Try parsing as RFC3339, which carries its own zone
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range absoluteTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	// Handle a bare time of day, such as "14:30", as a time today
+	if t, ok := parseClock(now, s); ok {
+		return t, nil
+	}
+
+	return time.Time{}, fmt.Errorf("unsupported time format: %s (use e.g. now-1h, 2d, 1w ago, yesterday, today 09:00, 2024-01-15 14:00 Europe/Berlin, RFC3339 or a Unix timestamp)", expr)
+}
+
+// splitZone removes a trailing timezone, such as Europe/Berlin, UTC or
+// +02:00, from an expression and returns it, or loc if there is none
+func splitZone(s string, loc *time.Location) (string, *time.Location) {
+	i := strings.LastIndexAny(s, " \t")
+	if i < 0 {
+		return s, loc
+	}
+	name := s[i+1:]
+
+	switch {
+	case name == "Z" || strings.EqualFold(name, "UTC") || strings.EqualFold(name, "GMT"):
+		return strings.TrimSpace(s[:i]), time.UTC
+	case name[0] == '+' || name[0] == '-':
+		for _, layout := range []string{"-07:00", "-0700", "-07"} {
+			if t, err := time.Parse(layout, name); err == nil {
+				_, offset := t.Zone()
+				return strings.TrimSpace(s[:i]), time.FixedZone(name, offset)
+			}
+		}
+	case strings.Contains(name, "/"):
+		if zone, err := time.LoadLocation(name); err == nil {
+			return strings.TrimSpace(s[:i]), zone
+		}
+	}
+	return s, loc
+}
+
+// timeOffset is an amount of a unit, e.g. 15m or 2d
+type timeOffset struct {
+	value float64
+	unit  string
+}
+
+// parseOffsets parses a sequence of offsets such as "1h30m", "2d" or
+// "1 hour 30 minutes"
+func parseOffsets(s string) ([]timeOffset, error) {
+	s = strings.Join(strings.Fields(s), "")
+	if s == "" {
+		return nil, fmt.Errorf("missing duration")
+	}
+
+	var offsets []timeOffset
+	for s != "" {
+		i := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' })
+		if i <= 0 {
+			return nil, fmt.Errorf("expected a number followed by a unit in %q", s)
+		}
+		value, err := strconv.ParseFloat(s[:i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", s[:i])
+		}
+		s = s[i:]
+
+		j := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsLetter(r) })
+		if j < 0 {
+			j = len(s)
+		}
+		unit, err := parseUnit(s[:j])
+		if err != nil {
+			return nil, err
+		}
+		s = s[j:]
+
+		offsets = append(offsets, timeOffset{value: value, unit: unit})
+	}
+	return offsets, nil
+}
+
+// parseUnit returns the canonical name of a time unit
+func parseUnit(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("missing unit")
+	}
+	if unit, ok := timeUnits[name]; ok {
+		return unit, nil
+	}
+	if unit, ok := timeUnits[strings.ToLower(name)]; ok {
+		return unit, nil
+	}
+	return "", fmt.Errorf("unknown unit %q (use s, m, h, d, w, M or y)", name)
+}
+
+// applyOffsets adds the offsets to t, or subtracts them if sign is -1. Days,
+// weeks, months and years follow the calendar, so a day is not always 24h
+// across a daylight saving change.
+func applyOffsets(t time.Time, offsets []timeOffset, sign int) (time.Time, error) {
+	for _, offset := range offsets {
+		value := float64(sign) * offset.value
+		if d, ok := fixedUnits[offset.unit]; ok {
+			t = t.Add(time.Duration(value * float64(d)))
+			continue
+		}
+
+		whole := value == math.Trunc(value)
+		switch {
+		case offset.unit == "d" && whole:
+			t = t.AddDate(0, 0, int(value))
+		case offset.unit == "d":
+			t = t.Add(time.Duration(value * float64(24*time.Hour)))
+		case offset.unit == "w" && whole:
+			t = t.AddDate(0, 0, 7*int(value))
+		case offset.unit == "w":
+			t = t.Add(time.Duration(value * float64(7*24*time.Hour)))
+		case !whole:
+			return time.Time{}, fmt.Errorf("fractional %s offsets are not supported", offset.unit)
+		case offset.unit == "M":
+			t = t.AddDate(0, int(value), 0)
+		case offset.unit == "y":
+			t = t.AddDate(int(value), 0, 0)
+		}
+	}
+	return t, nil
+}
+
+// parseNowExpr resolves the part of a Grafana style expression after "now":
+// any number of offsets like -1h or +30m, optionally followed by a rounding
+// unit like /d
+func parseNowExpr(now time.Time, expr string, roundUp bool) (time.Time, error) {
+	t := now
+	for expr != "" {
+		switch expr[0] {
+		case '/':
+			unit, err := parseUnit(expr[1:])
+			if err != nil {
+				return time.Time{}, err
+			}
+			return roundTime(t, unit, roundUp)
+		case '+', '-':
+			sign := 1
+			if expr[0] == '-' {
+				sign = -1
+			}
+			end := strings.IndexAny(expr[1:], "+-/")
+			if end < 0 {
+				end = len(expr) - 1
+			}
+			offsets, err := parseOffsets(expr[1 : end+1])
+			if err != nil {
+				return time.Time{}, err
+			}
+			if t, err = applyOffsets(t, offsets, sign); err != nil {
+				return time.Time{}, err
+			}
+			expr = expr[end+1:]
+		default:
+			return time.Time{}, fmt.Errorf("expected +, - or / after now")
+		}
+	}
+	return t, nil
+}
+
+// roundTime rounds t down to the start of the unit, such as the start of the
+// day for d, or with roundUp to the last instant of the unit. Weeks start on
+// Monday.
+func roundTime(t time.Time, unit string, roundUp bool) (time.Time, error) {
+	year, month, day := t.Date()
+	hour, minute, sec := t.Clock()
+	loc := t.Location()
+
+	var start, next time.Time
+	switch unit {
+	case "s":
+		start = time.Date(year, month, day, hour, minute, sec, 0, loc)
+		next = start.Add(time.Second)
+	case "m":
+		start = time.Date(year, month, day, hour, minute, 0, 0, loc)
+		next = start.Add(time.Minute)
+	case "h":
+		start = time.Date(year, month, day, hour, 0, 0, 0, loc)
+		next = start.Add(time.Hour)
+	case "d":
+		start = time.Date(year, month, day, 0, 0, 0, 0, loc)
+		next = start.AddDate(0, 0, 1)
+	case "w":
+		weekday := (int(t.Weekday()) + 6) % 7
+		start = time.Date(year, month, day-weekday, 0, 0, 0, 0, loc)
+		next = start.AddDate(0, 0, 7)
+	case "M":
+		start = time.Date(year, month, 1, 0, 0, 0, 0, loc)
+		next = start.AddDate(0, 1, 0)
+	case "y":
+		start = time.Date(year, 1, 1, 0, 0, 0, 0, loc)
+		next = start.AddDate(1, 0, 0)
+	default:
+		return time.Time{}, fmt.Errorf("cannot round to %s", unit)
+	}
+
+	if roundUp {
+		return next.Add(-time.Nanosecond), nil
+	}
+	return start, nil
+}
+
+// parseDayExpr resolves "today", "yesterday" or "tomorrow", optionally
+// followed by a time of day. It reports false if s does not start with one
+// of these words.
+func parseDayExpr(now time.Time, s string, roundUp bool) (time.Time, bool, error) {
+	word, clock, _ := strings.Cut(s, " ")
+	var days int
+	switch strings.ToLower(word) {
+	case "today":
+	case "yesterday":
+		days = -1
+	case "tomorrow":
+		days = 1
+	default:
+		return time.Time{}, false, nil
+	}
+
+	day := now.AddDate(0, 0, days)
+	clock = strings.TrimSpace(clock)
+	if clock == "" {
+		t, err := roundTime(day, "d", roundUp)
+		return t, true, err
+	}
+
+	t, ok := parseClock(day, clock)
+	if !ok {
+		return time.Time{}, true, fmt.Errorf("invalid time of day %q", clock)
+	}
+	return t, true, nil
+}
+
+// parseClock parses a time of day, such as 14:30 or 9am, on the day of t
+func parseClock(t time.Time, clock string) (time.Time, bool) {
+	clock = strings.ToUpper(strings.ReplaceAll(clock, " ", ""))
+	for _, layout := range clockLayouts {
+		c, err := time.Parse(layout, clock)
+		if err != nil {
+			continue
+		}
+		year, month, day := t.Date()
+		return time.Date(year, month, day, c.Hour(), c.Minute(), c.Second(), c.Nanosecond(), t.Location()), true
+	}
+	return time.Time{}, false
+}
+
+// minEpochDigits is the shortest Unix timestamp accepted, 1973 in seconds.
+// Shorter numbers such as 30 or 2024 are more likely a mistake than a time
+// in 1970.
+const minEpochDigits = 9
+
+// parseEpoch parses a Unix timestamp, telling the unit from the number of
+// digits: 9 or 10 for seconds (optionally with a fraction), 13 for
+// milliseconds, 16 for microseconds and 19 for nanoseconds. It reports
+// whether value is a number at all, and returns an error for a number too
+// short to be a plausible timestamp.
+func parseEpoch(value string) (time.Time, bool, error) {
+	whole, frac, hasFrac := strings.Cut(value, ".")
+	if whole == "" || strings.Trim(whole, "0123456789") != "" {
+		return time.Time{}, false, nil
+	}
+	if hasFrac && (frac == "" || len(frac) > 9 || strings.Trim(frac, "0123456789") != "" || len(whole) > 10) {
+		return time.Time{}, false, nil
+	}
+	if len(whole) < minEpochDigits {
+		return time.Time{}, true, fmt.Errorf("invalid Unix timestamp %q: expected at least %d digits, e.g. 1705312245; use a duration such as 30m for a relative time or 2024-01-15 for a date", value, minEpochDigits)
+	}
+
+	n, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return time.Time{}, false, nil
+	}
+
+	switch {
+	case len(whole) <= 10:
+		var nanos int64
+		if hasFrac {
+			nanos, _ = strconv.ParseInt(frac+strings.Repeat("0", 9-len(frac)), 10, 64)
+		}
+		return time.Unix(n, nanos), true, nil
+	case len(whole) <= 13:
+		return time.UnixMilli(n), true, nil
+	case len(whole) <= 16:
+		return time.UnixMicro(n), true, nil
+	default:
+		return time.Unix(0, n), true, nil
+	}
+}
+
+// resolvedTimes records the absolute times a tool call resolved its time
+// arguments to, so they can be reported in the tool result
+type resolvedTimes struct {
+	loc        *time.Location
+	start, end int64
+	hasRange   bool
+	at         int64
+	hasAt      bool
+}
+
+// recordRange notes the resolved start and end of a range query
+func (r *resolvedTimes) recordRange(loc *time.Location, start, end int64) {
+	if r == nil {
+		return
+	}
+	r.loc, r.start, r.end, r.hasRange = loc, start, end, true
+}
+
+// recordAt notes the resolved evaluation time of an instant query
+func (r *resolvedTimes) recordAt(loc *time.Location, at int64) {
+	if r == nil {
+		return
+	}
+	r.loc, r.at, r.hasAt = loc, at, true
+}
+
+// summary describes the resolved times, or returns "" if none were recorded
+func (r *resolvedTimes) summary() string {
+	if r == nil {
+		return ""
+	}
+	switch {
+	case r.hasRange:
+		return fmt.Sprintf("Time range: %s to %s (%s)", r.format(r.start), r.format(r.end), formatSpan(time.Duration(r.end-r.start)))
+	case r.hasAt:
+		return fmt.Sprintf("Evaluated at: %s", r.format(r.at))
+	}
+	return ""
+}
+
+// output returns the resolved times for machine-readable output, or nil if
+// none were recorded
+func (r *resolvedTimes) output() *RangeOutput {
+	switch {
+	case r == nil:
+		return nil
+	case r.hasRange:
+		return &RangeOutput{Start: r.format(r.start), End: r.format(r.end)}
+	case r.hasAt:
+		return &RangeOutput{Time: r.format(r.at)}
+	}
+	return nil
+}
+
+// format formats a nanosecond timestamp in the timezone it was resolved in
+func (r *resolvedTimes) format(nanos int64) string {
+	loc := r.loc
+	if loc == nil {
+		loc = time.UTC
+	}
+	return time.Unix(0, nanos).In(loc).Format(time.RFC3339Nano)
+}
+
+// formatSpan formats a duration without trailing zero units, e.g. 1h
+// instead of 1h0m0s
+func formatSpan(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
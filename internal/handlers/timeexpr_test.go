@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
+)
+
+// TestTimeParser_Expressions tests relative, rounded and absolute time expressions against a fixed now
+func TestTimeParser_Expressions(t *testing.T) {
+	// A Saturday
+	p := timeParser{now: time.Date(2026, 10, 17, 14, 30, 15, 0, time.UTC), loc: time.UTC}
+
+	testCases := map[string]string{
+		"now":                            "2026-10-17T14:30:15Z",
+		"NOW":                            "2026-10-17T14:30:15Z",
+		"now-15m":                        "2026-10-17T14:15:15Z",
+		"now - 15m":                      "2026-10-17T14:15:15Z",
+		"now-1h/h":                       "2026-10-17T13:00:00Z",
+		"now/d":                          "2026-10-17T00:00:00Z",
+		"now-1d/d":                       "2026-10-16T00:00:00Z",
+		"now-2h+30m":                     "2026-10-17T13:00:15Z",
+		"now/w":                          "2026-10-12T00:00:00Z",
+		"now/M":                          "2026-10-01T00:00:00Z",
+		"now-1M":                         "2026-09-17T14:30:15Z",
+		"now-1y/y":                       "2025-01-01T00:00:00Z",
+		"-1h":                            "2026-10-17T13:30:15Z",
+		"-1.5h":                          "2026-10-17T13:00:15Z",
+		"2d":                             "2026-10-15T14:30:15Z",
+		"1h30m":                          "2026-10-17T13:00:15Z",
+		"+1h":                            "2026-10-17T15:30:15Z",
+		"1w ago":                         "2026-10-10T14:30:15Z",
+		"2 hours ago":                    "2026-10-17T12:30:15Z",
+		"1 hour 30 minutes ago":          "2026-10-17T13:00:15Z",
+		"yesterday":                      "2026-10-16T00:00:00Z",
+		"today 09:00":                    "2026-10-17T09:00:00Z",
+		"Yesterday 23:15:30":             "2026-10-16T23:15:30Z",
+		"tomorrow 9am":                   "2026-10-18T09:00:00Z",
+		"14:00":                          "2026-10-17T14:00:00Z",
+		"2026-10-17 14:00 Europe/Berlin": "2026-10-17T12:00:00Z",
+		"2026-10-17 14:00 +05:30":        "2026-10-17T08:30:00Z",
+		"2026-10-17T14:00 UTC":           "2026-10-17T14:00:00Z",
+		"today 09:00 America/New_York":   "2026-10-17T13:00:00Z",
+		"2024-01-15":                     "2024-01-15T00:00:00Z",
+		"2024-01-15 10:00:00.5":          "2024-01-15T10:00:00.5Z",
+		"2024-01-15T10:00:00+02:00":      "2024-01-15T08:00:00Z",
+		"1705312245":                     "2024-01-15T09:50:45Z",
+	}
+
+	for expr, expected := range testCases {
+		parsed, err := p.parse(expr, false)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", expr, err)
+		} else if got := parsed.UTC().Format(time.RFC3339Nano); got != expected {
+			t.Errorf("%q: expected %s, got %s", expr, expected, got)
+		}
+	}
+}
+
+// TestTimeParser_RoundUp tests that rounded expressions and bare days resolve to the end of the period for an end time
+func TestTimeParser_RoundUp(t *testing.T) {
+	p := timeParser{now: time.Date(2026, 10, 17, 14, 30, 15, 0, time.UTC), loc: time.UTC}
+
+	testCases := map[string]string{
+		"now/d":       "2026-10-17T23:59:59.999999999Z",
+		"now-1h/h":    "2026-10-17T13:59:59.999999999Z",
+		"yesterday":   "2026-10-16T23:59:59.999999999Z",
+		"today 09:00": "2026-10-17T09:00:00Z",
+		"now-1h":      "2026-10-17T13:30:15Z",
+	}
+
+	for expr, expected := range testCases {
+		parsed, err := p.parse(expr, true)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", expr, err)
+		} else if got := parsed.UTC().Format(time.RFC3339Nano); got != expected {
+			t.Errorf("%q: expected %s, got %s", expr, expected, got)
+		}
+	}
+}
+
+// TestTimeParser_DefaultLocation tests that expressions without a zone are interpreted in the default timezone
+func TestTimeParser_DefaultLocation(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("Failed to load timezone: %v", err)
+	}
+	// The day daylight saving time ends in Berlin, so the day is 25h long
+	p := timeParser{now: time.Date(2026, 10, 25, 12, 0, 0, 0, berlin), loc: berlin}
+
+	testCases := map[string]string{
+		"today 09:00":          "2026-10-25T08:00:00Z",
+		"now/d":                "2026-10-24T22:00:00Z",
+		"now-1d":               "2026-10-24T10:00:00Z",
+		"2024-01-15 10:00":     "2024-01-15T09:00:00Z",
+		"2024-01-15 10:00 UTC": "2024-01-15T10:00:00Z",
+	}
+
+	for expr, expected := range testCases {
+		parsed, err := p.parse(expr, false)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", expr, err)
+		} else if got := parsed.UTC().Format(time.RFC3339Nano); got != expected {
+			t.Errorf("%q: expected %s, got %s", expr, expected, got)
+		}
+	}
+}
+
+// TestTimeParser_Invalid tests that malformed expressions are rejected
+func TestTimeParser_Invalid(t *testing.T) {
+	p := timeParser{now: time.Date(2026, 10, 17, 14, 30, 15, 0, time.UTC), loc: time.UTC}
+
+	for _, expr := range []string{"", "soon", "now-1x", "now*2", "now/q", "1.5M ago", "today 25:00", "2024-13-45", "5 parsecs ago"} {
+		if _, err := p.parse(expr, false); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+// TestTimeParser_ShortEpoch tests that numbers too short to be a Unix timestamp are rejected instead of resolving to 1970
+func TestTimeParser_ShortEpoch(t *testing.T) {
+	p := timeParser{now: time.Date(2026, 10, 17, 14, 30, 15, 0, time.UTC), loc: time.UTC}
+
+	for _, expr := range []string{"0", "30", "2024", "12345678", "1234.5"} {
+		if _, err := p.parse(expr, false); err == nil || !strings.Contains(err.Error(), "invalid Unix timestamp") {
+			t.Errorf("%q: expected an invalid Unix timestamp error, got %v", expr, err)
+		}
+	}
+	if got, err := p.parse("999999999", false); err != nil || !got.Equal(time.Unix(999999999, 0)) {
+		t.Errorf("Expected a 9 digit timestamp to be accepted, got %v (%v)", got, err)
+	}
+}
+
+// TestTimeParser_NonASCIIAgo tests that "ago" phrases with runes that change length when lowercased are rejected without panicking
+func TestTimeParser_NonASCIIAgo(t *testing.T) {
+	p := timeParser{now: time.Date(2026, 10, 17, 14, 30, 15, 0, time.UTC), loc: time.UTC}
+
+	for _, expr := range []string{"ȺȺȺȺ ago", "2 Kelvins ago", "ago"} {
+		if _, err := p.parse(expr, false); err == nil {
+			t.Errorf("%q: expected an error", expr)
+		}
+	}
+	if got, err := p.parse("2 Hours AGO", false); err != nil || !got.Equal(p.now.Add(-2*time.Hour)) {
+		t.Errorf("Expected a mixed-case phrase to be accepted, got %v (%v)", got, err)
+	}
+
+	_, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query": `{app="api"}`,
+		"start": "ȺȺȺȺ ago",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "invalid time expression") {
+		t.Errorf("Expected an invalid time expression error, got %v", err)
+	}
+}
+
+// TestDefaultLocation tests that the config file timezone takes precedence over the environment
+func TestDefaultLocation(t *testing.T) {
+	t.Setenv(config.EnvTimezone, "")
+	if loc, err := defaultLocation(); err != nil || loc != time.UTC {
+		t.Errorf("Expected UTC by default, got %v (%v)", loc, err)
+	}
+
+	t.Setenv(config.EnvTimezone, "America/New_York")
+	if loc, err := defaultLocation(); err != nil || loc.String() != "America/New_York" {
+		t.Errorf("Expected America/New_York, got %v (%v)", loc, err)
+	}
+
+	useConfig(t, &config.Config{Timezone: "Europe/Berlin"})
+	if loc, err := defaultLocation(); err != nil || loc.String() != "Europe/Berlin" {
+		t.Errorf("Expected Europe/Berlin, got %v (%v)", loc, err)
+	}
+}
+
+// TestHandleLokiQuery_ReportsTimeRange tests that the resolved range is sent to Loki and reported in the default timezone
+func TestHandleLokiQuery_ReportsTimeRange(t *testing.T) {
+	t.Setenv(config.EnvTimezone, "Europe/Berlin")
+	var last *http.Request
+	server := recordingLokiServer(t, &last)
+
+	result, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query": `{app="api"}`,
+		"url":   server.URL,
+		"start": "2024-01-15 10:00",
+		"end":   "2024-01-15 11:30",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+
+	if q := last.URL.Query(); q.Get("start") != "1705309200000000000" || q.Get("end") != "1705314600000000000" {
+		t.Errorf("Unexpected range sent to Loki: %s", last.URL.RawQuery)
+	}
+	expected := "Time range: 2024-01-15T10:00:00+01:00 to 2024-01-15T11:30:00+01:00 (1h30m)"
+	if text := resultText(t, result); !strings.HasSuffix(text, expected) {
+		t.Errorf("Expected the result to end with %q, got %q", expected, text)
+	}
+}
+
+// TestHandleLokiInstantQuery_ReportsTime tests that the resolved evaluation time is reported
+func TestHandleLokiInstantQuery_ReportsTime(t *testing.T) {
+	var last *http.Request
+	server := recordingLokiServer(t, &last)
+
+	result, err := HandleLokiInstantQuery(context.Background(), newCallToolRequest(map[string]any{
+		"query": `count_over_time({app="api"}[5m])`,
+		"url":   server.URL,
+		"time":  "2024-01-15 10:00 Europe/Berlin",
+	}))
+	if err != nil {
+		t.Fatalf("HandleLokiInstantQuery failed: %v", err)
+	}
+
+	if q := last.URL.Query(); q.Get("time") != "1705309200000000000" {
+		t.Errorf("Unexpected time sent to Loki: %s", last.URL.RawQuery)
+	}
+	expected := "Evaluated at: 2024-01-15T09:00:00Z"
+	if text := resultText(t, result); !strings.HasSuffix(text, expected) {
+		t.Errorf("Expected the result to end with %q, got %q", expected, text)
+	}
+}
+
+// TestHandleLokiQuery_EntryTimesInDefaultTimezone tests that log lines are printed in the same timezone as the time range, regardless of the server's local zone
+func TestHandleLokiQuery_EntryTimesInDefaultTimezone(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("server", -7*3600)
+	defer func() { time.Local = local }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[
+			{"stream":{"app":"api"},"values":[["1705312245000000000","boom"]]}
+		]}}`))
+	}))
+	defer server.Close()
+
+	args := map[string]any{
+		"query": `{app="api"}`,
+		"url":   server.URL,
+		"start": "2024-01-15 10:00",
+		"end":   "2024-01-15 11:00",
+	}
+	result, err := HandleLokiQuery(context.Background(), newCallToolRequest(args))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if text := resultText(t, result); !strings.Contains(text, "[2024-01-15T09:50:45Z] boom\n") {
+		t.Errorf("Expected the line in UTC by default, got:\n%s", text)
+	}
+
+	t.Setenv(config.EnvTimezone, "Europe/Berlin")
+	result, err = HandleLokiQuery(context.Background(), newCallToolRequest(args))
+	if err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if text := resultText(t, result); !strings.Contains(text, "[2024-01-15T10:50:45+01:00] boom\n") ||
+		!strings.Contains(text, "Time range: 2024-01-15T10:00:00+01:00") {
+		t.Errorf("Expected the line and range in Europe/Berlin, got:\n%s", text)
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
+)
+
+// Request timeouts. The default applies to every request sent to Loki, and a
+// tool call may raise it with the timeout argument up to the maximum.
+const (
+	defaultRequestTimeout    = 30 * time.Second
+	defaultMaxRequestTimeout = 5 * time.Minute
+)
+
+// transportKey identifies a shared transport. Timeouts are applied per
+// request, so they are not part of the key.
+type transportKey struct {
+	tls  config.TLSConfig
+	http config.HTTPConfig
+}
+
+// sharedClient is a shared HTTP client and the version of the certificate
+// files it was built from
+type sharedClient struct {
+	client   *http.Client
+	tlsFiles string
+}
+
+// Shared HTTP clients keyed by their TLS and HTTP settings, so that every
+// Loki tool reuses the same connections instead of dialing anew on each call
+var (
+	httpClientsMu sync.Mutex
+	httpClients   = make(map[transportKey]sharedClient)
+)
+
+// httpClientFor returns the shared HTTP client for the given TLS and HTTP
+// settings, creating it on first use and again whenever one of the
+// certificate files changes, so rotated certificates are picked up. The
+// client has no timeout of its own; callers bound each request with a
+// context deadline.
+func httpClientFor(tlsSettings config.TLSConfig, httpSettings config.HTTPConfig) (*http.Client, error) {
+	httpSettings.Timeout = 0
+	httpSettings.MaxTimeout = 0
+	key := transportKey{tls: tlsSettings, http: httpSettings}
+	tlsFiles := tlsFilesVersion(tlsSettings)
+
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+
+	shared, ok := httpClients[key]
+	if ok && shared.tlsFiles == tlsFiles {
+		return shared.client, nil
+	}
+
+	transport, err := newHTTPTransport(tlsSettings, httpSettings)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		shared.client.CloseIdleConnections()
+	}
+
+	client := &http.Client{Transport: transport}
+	httpClients[key] = sharedClient{client: client, tlsFiles: tlsFiles}
+	return client, nil
+}
+
+// tlsFilesVersion identifies the current contents of the certificate files
+// by their modification time and size
+func tlsFilesVersion(tlsSettings config.TLSConfig) string {
+	var version strings.Builder
+	for _, file := range []string{tlsSettings.CAFile, tlsSettings.CertFile, tlsSettings.KeyFile} {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&version, "%d:%d;", info.ModTime().UnixNano(), info.Size())
+		} else {
+			version.WriteString("missing;")
+		}
+	}
+	return version.String()
+}
+
+// newHTTPTransport builds a transport from the defaults of
+// http.DefaultTransport and the given settings
+func newHTTPTransport(tlsSettings config.TLSConfig, httpSettings config.HTTPConfig) (*http.Transport, error) {
+	tlsConfig, err := tlsSettings.Build()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %v", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if httpSettings.KeepAlive > 0 {
+		dialer.KeepAlive = httpSettings.KeepAlive
+	}
+	transport.DialContext = dialer.DialContext
+
+	if httpSettings.MaxIdleConns > 0 {
+		transport.MaxIdleConns = httpSettings.MaxIdleConns
+	}
+	if httpSettings.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = httpSettings.MaxIdleConnsPerHost
+	}
+	if httpSettings.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = httpSettings.MaxConnsPerHost
+	}
+	if httpSettings.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = httpSettings.IdleConnTimeout
+	}
+	transport.DisableKeepAlives = httpSettings.DisableKeepAlives
+
+	// By default the proxy comes from HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	switch {
+	case httpSettings.DisableProxy:
+		transport.Proxy = nil
+	case httpSettings.ProxyURL != "":
+		proxyURL, err := url.Parse(httpSettings.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return transport, nil
+}
+
+// httpTransportFor returns the transport of the shared HTTP client for the
+// given settings, for connections that cannot use an http.Client such as the
+// tail WebSocket
+func httpTransportFor(tlsSettings config.TLSConfig, httpSettings config.HTTPConfig) (*http.Transport, error) {
+	client, err := httpClientFor(tlsSettings, httpSettings)
+	if err != nil {
+		return nil, err
+	}
+	return client.Transport.(*http.Transport), nil
+}
+
+// requestTimeout returns the timeout for a request: the timeout argument if
+// set, otherwise the configured timeout, capped at the configured maximum
+func requestTimeout(httpSettings config.HTTPConfig, args map[string]any) (time.Duration, error) {
+	timeout := defaultRequestTimeout
+	if httpSettings.Timeout > 0 {
+		timeout = httpSettings.Timeout
+	}
+	maxTimeout := defaultMaxRequestTimeout
+	if httpSettings.MaxTimeout > 0 {
+		maxTimeout = httpSettings.MaxTimeout
+	}
+	if maxTimeout < timeout {
+		maxTimeout = timeout
+	}
+
+	if timeoutArg, ok := args["timeout"].(string); ok && timeoutArg != "" {
+		d, err := time.ParseDuration(timeoutArg)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("invalid timeout: %s", timeoutArg)
+		}
+		timeout = d
+	}
+
+	if timeout > maxTimeout {
+		timeout = maxTimeout
+	}
+	return timeout, nil
+}
@@ -0,0 +1,359 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/scottlepp/loki-mcp/internal/config"
+)
+
+// writeCertificatePEM writes the PEM encoding of a DER certificate to a temporary file
+func writeCertificatePEM(t *testing.T, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeClientCertificate generates a self-signed client certificate and key
+// and returns the parsed certificate along with the file paths
+func writeClientCertificate(t *testing.T) (*x509.Certificate, string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "loki-mcp"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, writeCertificatePEM(t, der), keyFile
+}
+
+// lokiEmptyResponse is a successful query response without any streams
+const lokiEmptyResponse = `{"status":"success","data":{"resultType":"streams","result":[]}}`
+
+// TestExecuteLokiRequest_CustomCA tests that a Loki server signed by a private CA is reachable once the CA is configured
+func TestExecuteLokiRequest_CustomCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(lokiEmptyResponse))
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiURL, server.URL)
+	args := map[string]any{"query": `{app="api"}`}
+
+	// Without the CA the server certificate cannot be verified
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(args)); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("Expected certificate verification error, got %v", err)
+	}
+
+	t.Setenv(config.EnvLokiCAFile, writeCertificatePEM(t, server.Certificate().Raw))
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(args)); err != nil {
+		t.Errorf("Expected query to succeed with the CA configured, got %v", err)
+	}
+}
+
+// TestExecuteLokiRequest_EnvTLSOnlyForLokiURL tests that the environment TLS settings are not applied to another URL
+func TestExecuteLokiRequest_EnvTLSOnlyForLokiURL(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(lokiEmptyResponse))
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiURL, "https://loki.internal:3100")
+	t.Setenv(config.EnvLokiCAFile, writeCertificatePEM(t, server.Certificate().Raw))
+
+	args := map[string]any{"query": `{app="api"}`, "url": server.URL}
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(args)); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("Expected certificate verification error for a URL other than LOKI_URL, got %v", err)
+	}
+
+	// A datasource without TLS settings does not inherit them either
+	useConfig(t, &config.Config{Datasources: []config.Datasource{{Name: "prod", URL: server.URL}}})
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`})); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("Expected certificate verification error for a datasource, got %v", err)
+	}
+}
+
+// TestExecuteLokiRequest_InsecureSkipVerify tests the explicit opt-out of certificate verification
+func TestExecuteLokiRequest_InsecureSkipVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(lokiEmptyResponse))
+	}))
+	defer server.Close()
+
+	t.Setenv(EnvLokiURL, server.URL)
+	t.Setenv(config.EnvLokiInsecureSkipVerify, "true")
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`})); err != nil {
+		t.Errorf("Expected query to succeed with verification disabled, got %v", err)
+	}
+}
+
+// TestExecuteLokiRequest_MutualTLS tests that the client certificate is presented to a server requiring mTLS
+func TestExecuteLokiRequest_MutualTLS(t *testing.T) {
+	clientCert, certFile, keyFile := writeClientCertificate(t)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(lokiEmptyResponse))
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	args := map[string]any{"query": `{app="api"}`}
+	t.Setenv(EnvLokiURL, server.URL)
+	t.Setenv(config.EnvLokiCAFile, writeCertificatePEM(t, server.Certificate().Raw))
+
+	// Without a client certificate the handshake is rejected
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(args)); err == nil {
+		t.Errorf("Expected query without client certificate to fail")
+	}
+
+	t.Setenv(config.EnvLokiClientCertFile, certFile)
+	t.Setenv(config.EnvLokiClientKeyFile, keyFile)
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(args)); err != nil {
+		t.Errorf("Expected query to succeed with client certificate, got %v", err)
+	}
+}
+
+// TestExecuteLokiRequest_RotatedClientCertificate tests that a client certificate replaced on disk is picked up
+func TestExecuteLokiRequest_RotatedClientCertificate(t *testing.T) {
+	_, oldCertFile, oldKeyFile := writeClientCertificate(t)
+	newCert, newCertFile, newKeyFile := writeClientCertificate(t)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(newCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(lokiEmptyResponse))
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	// Start with a certificate the server does not trust
+	certFile := filepath.Join(t.TempDir(), "client.pem")
+	keyFile := filepath.Join(t.TempDir(), "client-key.pem")
+	copyFile(t, oldCertFile, certFile)
+	copyFile(t, oldKeyFile, keyFile)
+
+	args := map[string]any{"query": `{app="api"}`}
+	t.Setenv(EnvLokiURL, server.URL)
+	t.Setenv(config.EnvLokiCAFile, writeCertificatePEM(t, server.Certificate().Raw))
+	t.Setenv(config.EnvLokiClientCertFile, certFile)
+	t.Setenv(config.EnvLokiClientKeyFile, keyFile)
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(args)); err == nil {
+		t.Fatalf("Expected query with an untrusted client certificate to fail")
+	}
+
+	// Rotate the certificate in place
+	copyFile(t, newCertFile, certFile)
+	copyFile(t, newKeyFile, keyFile)
+	later := time.Now().Add(time.Minute)
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(args)); err != nil {
+		t.Errorf("Expected query to succeed with the rotated certificate, got %v", err)
+	}
+}
+
+// copyFile copies the file at src to dst
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dst, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRequestTimeout tests the default, configured and requested timeouts and their cap
+func TestRequestTimeout(t *testing.T) {
+	testCases := []struct {
+		name     string
+		settings config.HTTPConfig
+		timeout  string
+		expected time.Duration
+	}{
+		{"default", config.HTTPConfig{}, "", defaultRequestTimeout},
+		{"requested", config.HTTPConfig{}, "2m", 2 * time.Minute},
+		{"capped at default max", config.HTTPConfig{}, "1h", defaultMaxRequestTimeout},
+		{"configured", config.HTTPConfig{Timeout: time.Minute}, "", time.Minute},
+		{"capped at configured max", config.HTTPConfig{MaxTimeout: 90 * time.Second}, "10m", 90 * time.Second},
+	}
+
+	for _, tc := range testCases {
+		args := map[string]any{}
+		if tc.timeout != "" {
+			args["timeout"] = tc.timeout
+		}
+		timeout, err := requestTimeout(tc.settings, args)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if timeout != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.expected, timeout)
+		}
+	}
+
+	if _, err := requestTimeout(config.HTTPConfig{}, map[string]any{"timeout": "soon"}); err == nil {
+		t.Errorf("Expected an error for an invalid timeout")
+	}
+}
+
+// TestExecuteLokiRequest_Timeout tests that a slow Loki fails once the requested timeout elapses
+func TestExecuteLokiRequest_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		w.Write([]byte(lokiEmptyResponse))
+	}))
+	defer server.Close()
+
+	args := map[string]any{"query": `{app="api"}`, "url": server.URL, "timeout": "50ms"}
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(args)); err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+}
+
+// TestExecuteLokiRequest_TimeoutCoversRetries tests that the timeout bounds the whole tool call rather than each attempt
+func TestExecuteLokiRequest_TimeoutCoversRetries(t *testing.T) {
+	t.Setenv(config.EnvLokiRetryInitialBackoff, "1ms")
+	t.Setenv(config.EnvLokiRetryMaxAttempts, "10")
+
+	var requests int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(150 * time.Millisecond):
+		}
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer slow.Close()
+
+	started := time.Now()
+	_, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`, "url": slow.URL, "timeout": "400ms"}))
+	if err == nil || !strings.Contains(err.Error(), "timed out after 400ms") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second || atomic.LoadInt32(&requests) >= 10 {
+		t.Errorf("Expected the retries to stop at the timeout, took %s for %d requests", elapsed, requests)
+	}
+
+	// A backoff that would pass the deadline is not waited for
+	t.Setenv(config.EnvLokiRetryInitialBackoff, "500ms")
+	requests = 0
+	failing := flakyLokiServer(t, &requests, failWith(http.StatusServiceUnavailable, ""))
+	started = time.Now()
+	_, err = HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`, "url": failing.URL, "timeout": "200ms"}))
+	if err == nil || !strings.Contains(err.Error(), "not retried: the timeout of 200ms would pass first") {
+		t.Errorf("Expected a not retried error, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 300*time.Millisecond || requests != 1 {
+		t.Errorf("Expected no retry past the timeout, took %s for %d requests", elapsed, requests)
+	}
+}
+
+// TestExecuteLokiRequest_ProxyURL tests that requests are sent through a configured HTTP proxy
+func TestExecuteLokiRequest_ProxyURL(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte(lokiEmptyResponse))
+	}))
+	defer proxy.Close()
+
+	useConfig(t, &config.Config{
+		Datasources: []config.Datasource{{
+			Name: "prod",
+			URL:  "http://loki.internal:3100",
+			HTTP: config.HTTPConfig{ProxyURL: proxy.URL},
+		}},
+	})
+
+	if _, err := HandleLokiQuery(context.Background(), newCallToolRequest(map[string]any{"query": `{app="api"}`})); err != nil {
+		t.Fatalf("HandleLokiQuery failed: %v", err)
+	}
+	if !strings.HasPrefix(proxied, "http://loki.internal:3100/loki/api/v1/query_range") {
+		t.Errorf("Expected the request to go through the proxy, got %q", proxied)
+	}
+}
+
+// TestHTTPClientFor_Shared tests that connections are shared regardless of the request timeout
+func TestHTTPClientFor_Shared(t *testing.T) {
+	settings := config.HTTPConfig{MaxIdleConnsPerHost: 20, Timeout: time.Minute}
+	first, err := httpClientFor(config.TLSConfig{}, settings)
+	if err != nil {
+		t.Fatalf("httpClientFor failed: %v", err)
+	}
+
+	settings.Timeout = 2 * time.Minute
+	second, err := httpClientFor(config.TLSConfig{}, settings)
+	if err != nil {
+		t.Fatalf("httpClientFor failed: %v", err)
+	}
+	if first != second {
+		t.Errorf("Expected the same client for different timeouts")
+	}
+	if transport := first.Transport.(*http.Transport); transport.MaxIdleConnsPerHost != 20 {
+		t.Errorf("Expected MaxIdleConnsPerHost 20, got %d", transport.MaxIdleConnsPerHost)
+	}
+}